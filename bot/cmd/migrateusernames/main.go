@@ -0,0 +1,22 @@
+// Command migrateusernames gives the usernames set before username claims
+// existed a claim, so the look-alike check covers them. It runs on every
+// deploy and only adds the claims still missing.
+package main
+
+import (
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"log"
+)
+
+func main() {
+	userRepo, err := users.NewUserRepository(users.NewDB())
+	if err != nil {
+		log.Fatalf("failed to init user repo: %s", err)
+	}
+
+	added, err := userRepo.BackfillUsernameClaims()
+	if err != nil {
+		log.Fatalf("failed to backfill username claims: %s", err)
+	}
+	log.Printf("%d username claims backfilled", added)
+}
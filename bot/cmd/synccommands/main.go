@@ -0,0 +1,24 @@
+// Command synccommands publishes the localized command menus of the bot to
+// Telegram. It runs on every deploy so the menus follow the commands and
+// translations of the deployed version.
+package main
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/bugfloyd/anonymous-telegram-bot/common"
+	"github.com/bugfloyd/anonymous-telegram-bot/secrets"
+	"log"
+)
+
+func main() {
+	b, err := gotgbot.NewBot(secrets.BotToken, nil)
+	if err != nil {
+		log.Fatalf("failed to create new bot: %s", err)
+	}
+
+	err = common.SyncCommands(b)
+	if err != nil {
+		log.Fatalf("failed to sync commands: %s", err)
+	}
+	log.Println("command menus synced")
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+)
+
+func (r *RequestContext) deleteMe(b *gotgbot.Bot, ctx *ext.Context) error {
+	_, err := b.SendMessage(ctx.EffectiveChat.Id, r.locale.T(i18n.DeleteAccountWarningText), &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+				{
+					{
+						Text:         r.locale.T(i18n.DeleteAccountButtonText),
+						CallbackData: confirmDeleteButton,
+					},
+					{
+						Text:         r.locale.T(i18n.CancelButtonText),
+						CallbackData: cancelDeleteButton,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send delete account warning: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RequestContext) deleteAccountCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
+	cb := ctx.Update.CallbackQuery
+
+	if action == "CANCEL" {
+		// Remove delete account buttons
+		_, _, err := cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{})
+		if err != nil {
+			return fmt.Errorf("failed to update delete account message markup: %w", err)
+		}
+
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.NeverMindButtonText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "CONFIRM" {
+		// Ask once more before deleting anything
+		_, _, err := cb.Message.EditText(b, r.locale.T(i18n.DeleteAccountFinalWarningText), &gotgbot.EditMessageTextOpts{
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+					{
+						{
+							Text:         r.locale.T(i18n.DeleteForeverButtonText),
+							CallbackData: deleteAccountButton,
+						},
+						{
+							Text:         r.locale.T(i18n.CancelButtonText),
+							CallbackData: cancelDeleteButton,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update delete account message: %w", err)
+		}
+
+		_, err = cb.Answer(b, nil)
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "DELETE" {
+		err := r.deleteAccount()
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+
+		_, _, err = cb.Message.EditText(b, r.locale.T(i18n.AccountDeletedText), &gotgbot.EditMessageTextOpts{})
+		if err != nil {
+			return fmt.Errorf("failed to update delete account message: %w", err)
+		}
+
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.AccountDeletedText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteAccount removes the user and everything tied to it. The user item goes
+// last so a failed attempt can be retried with the same command.
+func (r *RequestContext) deleteAccount() error {
+	err := r.jobRepo.DeleteOwnerJobs(r.user)
+	if err != nil {
+		return err
+	}
+
+	err = r.messageRepo.DeleteUserMessages(r.user)
+	if err != nil {
+		return err
+	}
+
+	err = r.blockRepo.DeleteAllBlocks(r.user)
+	if err != nil {
+		return err
+	}
+
+	// Legacy blacklists of other users still naming the user leave it out once they are migrated
+	err = r.blockRepo.DeleteBlocksAgainst(r.user)
+	if err != nil {
+		return err
+	}
+
+	err = r.userRepo.DeleteUserSlugs(r.user)
+	if err != nil {
+		return err
+	}
+
+	return r.userRepo.DeleteUser(r.user)
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// adminUserIDs are the Telegram user IDs allowed to run the admin commands,
+// given as a comma separated ADMIN_USER_IDS list
+var adminUserIDs = parseUserIDs(os.Getenv("ADMIN_USER_IDS"))
+
+func parseUserIDs(list string) []int64 {
+	var ids []int64
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Printf("ignoring invalid admin user ID %q", field)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func isAdmin(userID int64) bool {
+	for _, id := range adminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
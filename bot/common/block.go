@@ -4,29 +4,140 @@ import (
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
-	"slices"
-	"strings"
+	"time"
 )
 
-func (r *RootHandler) blockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+const blockedPageSize = 5
+
+func (r *RequestContext) blockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data blockData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	var buttons [][]gotgbot.InlineKeyboardButton
+	var row []gotgbot.InlineKeyboardButton
+	for _, option := range []struct {
+		textID   i18n.TextID
+		duration string
+	}{
+		{i18n.BlockOneHourButtonText, "h"},
+		{i18n.BlockOneDayButtonText, "d"},
+		{i18n.BlockOneWeekButtonText, "w"},
+		{i18n.BlockForeverButtonText, "f"},
+		{i18n.MuteButtonText, "m"},
+	} {
+		callbackData, err := callbacks.Encode(blockDurationData{
+			ContactUUID: data.ContactUUID,
+			MessageID:   data.MessageID,
+			Duration:    option.duration,
+		})
+		if err != nil {
+			return err
+		}
+		row = append(row, gotgbot.InlineKeyboardButton{
+			Text:         r.locale.T(option.textID),
+			CallbackData: callbackData,
+		})
+		if len(row) == 4 {
+			buttons = append(buttons, row)
+			row = nil
+		}
+	}
+	cancelData, err := callbacks.Encode(blockCancelData(data))
+	if err != nil {
+		return err
+	}
+	buttons = append(buttons, append(row, gotgbot.InlineKeyboardButton{
+		Text:         r.locale.T(i18n.CancelButtonText),
+		CallbackData: cancelData,
+	}))
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: r.locale.T(i18n.ChooseBlockDurationText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	_, _, err = cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: buttons,
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to update message markup: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RequestContext) blockDurationCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
-	split := strings.Split(cb.Data, "|")
-	if len(split) != 3 {
-		return fmt.Errorf("invalid callback data: %s", cb.Data)
+	var data blockDurationData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	mode := users.Blocked
+	var duration time.Duration
+	var buttonText, answer string
+	switch data.Duration {
+	case "h":
+		duration = time.Hour
+	case "d":
+		duration = 24 * time.Hour
+	case "w":
+		duration = 7 * 24 * time.Hour
+	case "f":
+	case "m":
+		mode = users.Muted
+	default:
+		return fmt.Errorf("%w: unknown block duration %s", callbacks.ErrInvalid, data.Duration)
+	}
+
+	switch {
+	case mode == users.Muted:
+		buttonText = r.locale.T(i18n.UnmuteButtonText)
+		answer = r.locale.T(i18n.UserMutedText)
+	case duration > 0:
+		buttonText = r.locale.T(i18n.UnblockButtonText)
+		answer = r.locale.T(i18n.UserBlockedForText, i18n.Args{"duration": r.locale.Duration(duration)})
+	default:
+		buttonText = r.locale.T(i18n.UnblockButtonText)
+		answer = r.locale.T(i18n.UserBlockedText)
 	}
-	receiverUUID := split[1]
-	replyMessageID := split[2]
 
-	err := r.userRepo.UpdateBlacklist(r.user, "add", receiverUUID)
+	unBlockButtonData, err := callbacks.Encode(unBlockData{
+		ContactUUID: data.ContactUUID,
+		MessageID:   data.MessageID,
+	})
+	if err != nil {
+		return err
+	}
 
+	// Keep a snippet of the blocked message to recognize the conversation later
+	var snippet string
+	if data.MessageID != 0 {
+		snippet = ctx.EffectiveMessage.Text
+		if snippet == "" {
+			snippet = ctx.EffectiveMessage.Caption
+		}
+	}
+	_, err = r.blockRepo.CreateBlock(r.user, data.ContactUUID, mode, duration, users.BlockedByUser, snippet)
 	if err != nil {
 		return fmt.Errorf("failed to block user: %w", err)
 	}
 
 	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-		Text: i18n.T(i18n.UserBlockedText),
+		Text: answer,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to answer callback: %w", err)
@@ -37,8 +148,8 @@ func (r *RootHandler) blockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 				{
 					{
-						Text:         i18n.T(i18n.UnblockButtonText),
-						CallbackData: fmt.Sprintf("ub|%s|%s", receiverUUID, replyMessageID),
+						Text:         buttonText,
+						CallbackData: unBlockButtonData,
 					},
 				},
 			},
@@ -52,81 +163,320 @@ func (r *RootHandler) blockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func (r *RootHandler) unBlockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+func (r *RequestContext) blockCancelCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data blockCancelData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	keyboard, err := r.messageKeyboard(data.ContactUUID, data.MessageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: r.locale.T(i18n.NeverMindButtonText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	_, _, err = cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update message markup: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RequestContext) unBlockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
-	split := strings.Split(cb.Data, "|")
-	if len(split) != 3 {
-		return fmt.Errorf("invalid callback data: %s", cb.Data)
+	var data unBlockData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
 	}
-	receiverUUID := split[1]
-	replyMessageID := split[2]
 
-	err := r.userRepo.UpdateBlacklist(r.user, "delete", receiverUUID)
+	keyboard, err := r.messageKeyboard(data.ContactUUID, data.MessageID)
+	if err != nil {
+		return err
+	}
 
+	err = r.blockRepo.DeleteBlock(r.user, data.ContactUUID)
 	if err != nil {
 		return fmt.Errorf("failed to unblock user: %w", err)
 	}
 
 	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-		Text: i18n.T(i18n.UserUnblockedText),
+		Text: r.locale.T(i18n.UserUnblockedText),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to answer callback: %w", err)
 	}
 
-	var replyMessageKey gotgbot.InlineKeyboardButton
-	if replyMessageID == "0" {
-		replyMessageKey = gotgbot.InlineKeyboardButton{
-			Text:         i18n.T(i18n.SendMessageButtonText),
-			CallbackData: fmt.Sprintf("r|%s|%s", receiverUUID, replyMessageID),
-		}
-	} else {
-		replyMessageKey = gotgbot.InlineKeyboardButton{
-			Text:         i18n.T(i18n.ReplyButtonText),
-			CallbackData: fmt.Sprintf("r|%s|%s", receiverUUID, replyMessageID),
-		}
+	_, _, err = cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: keyboard,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to update message markup: %w", err)
 	}
 
-	_, _, err = cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
-		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
-			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+	return nil
+}
+
+// messageKeyboard builds the reply and block buttons of a conversation message
+func (r *RequestContext) messageKeyboard(contactUUID string, messageID int64) (gotgbot.InlineKeyboardMarkup, error) {
+	replyButtonData, err := callbacks.Encode(replyData{
+		ContactUUID: contactUUID,
+		MessageID:   messageID,
+	})
+	if err != nil {
+		return gotgbot.InlineKeyboardMarkup{}, err
+	}
+	blockButtonData, err := callbacks.Encode(blockData{
+		ContactUUID: contactUUID,
+		MessageID:   messageID,
+	})
+	if err != nil {
+		return gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	replyButtonText := r.locale.T(i18n.ReplyButtonText)
+	if messageID == 0 {
+		replyButtonText = r.locale.T(i18n.SendMessageButtonText)
+	}
+
+	return gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
 				{
-					replyMessageKey,
-					{
-						Text:         i18n.T(i18n.BlockButtonText),
-						CallbackData: fmt.Sprintf("b|%s|%s", receiverUUID, replyMessageID),
-					},
+					Text:         replyButtonText,
+					CallbackData: replyButtonData,
+				},
+				{
+					Text:         r.locale.T(i18n.BlockButtonText),
+					CallbackData: blockButtonData,
 				},
 			},
 		},
-	})
+	}, nil
+}
 
+func (r *RequestContext) unBlockAll(b *gotgbot.Bot, ctx *ext.Context) error {
+	err := r.blockRepo.DeleteAllBlocks(r.user)
 	if err != nil {
-		return fmt.Errorf("failed to update message markup: %w", err)
+		return fmt.Errorf("failed to unblock all users: %w", err)
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.UnblockAllUsersResultText), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send bot info: %w", err)
 	}
 
 	return nil
 }
 
-func (r *RootHandler) unBlockAll(b *gotgbot.Bot, ctx *ext.Context) error {
-	err := r.userRepo.UpdateBlacklist(r.user, "clear", "")
+func (r *RequestContext) listBlocked(b *gotgbot.Bot, ctx *ext.Context) error {
+	text, keyboard, err := r.blockedPage(0, false)
 	if err != nil {
-		return fmt.Errorf("failed to unblock all users: %w", err)
+		return err
 	}
 
-	_, err = ctx.EffectiveMessage.Reply(b, i18n.T(i18n.UnblockAllUsersResultText), nil)
+	_, err = b.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send bot info: %w", err)
+		return fmt.Errorf("failed to send blocked users list: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RequestContext) blockedPageCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data blockedPageData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	return r.updateBlockedPage(b, cb, data.Page, data.Menu)
+}
+
+func (r *RequestContext) blockedUnblockCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data blockedUnblockData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	err = r.blockRepo.DeleteBlock(r.user, data.BlockedUUID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: r.locale.T(i18n.UserUnblockedText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	return r.updateBlockedPage(b, cb, data.Page, data.Menu)
+}
+
+func (r *RequestContext) updateBlockedPage(b *gotgbot.Bot, cb *gotgbot.CallbackQuery, page int, inMenu bool) error {
+	text, keyboard, err := r.blockedPage(page, inMenu)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = cb.Message.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update blocked users list: %w", err)
 	}
 
 	return nil
 }
 
-func blockCheck(sender *users.User, receiver *users.User) BlockedBy {
-	if slices.Contains(sender.Blacklist, receiver.UUID) {
-		return Sender
-	} else if slices.Contains(receiver.Blacklist, sender.UUID) {
-		return Receiver
+// blockedPage renders one page of the blocked users list with its keyboard. A
+// list opened from the settings menu leads back to it.
+func (r *RequestContext) blockedPage(page int, inMenu bool) (string, gotgbot.InlineKeyboardMarkup, error) {
+	blocks, err := r.blockRepo.ReadBlocks(r.user)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	var backRow []gotgbot.InlineKeyboardButton
+	if inMenu {
+		backButton, err := menuButton(r.locale.T(i18n.BackButtonText), settingsBlockedPage, "")
+		if err != nil {
+			return "", gotgbot.InlineKeyboardMarkup{}, err
+		}
+		backRow = []gotgbot.InlineKeyboardButton{backButton}
+	}
+	if len(blocks) == 0 {
+		var buttons [][]gotgbot.InlineKeyboardButton
+		if backRow != nil {
+			buttons = append(buttons, backRow)
+		}
+		return r.locale.T(i18n.NoBlockedUsersText), gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons}, nil
+	}
+
+	pages := (len(blocks) + blockedPageSize - 1) / blockedPageSize
+	page = max(0, min(page, pages-1))
+	blocks = blocks[page*blockedPageSize : min((page+1)*blockedPageSize, len(blocks))]
+
+	text := r.locale.T(i18n.BlockedUsersListText, i18n.Args{"page": page + 1, "pages": pages})
+	var buttons [][]gotgbot.InlineKeyboardButton
+	for _, block := range blocks {
+		label := r.locale.T(i18n.AnonymousLabelText, i18n.Args{"label": block.Label})
+		statusID, buttonTextID := i18n.BlockedAgoText, i18n.UnblockUserButtonText
+		if block.IsMuted() {
+			statusID, buttonTextID = i18n.MutedAgoText, i18n.UnmuteUserButtonText
+		}
+		status := r.locale.T(statusID, i18n.Args{"ago": r.locale.TimeAgo(block.CreatedAt)})
+		buttonText := r.locale.T(buttonTextID, i18n.Args{"user": label})
+		text += fmt.Sprintf("\n\n%s, %s", label, status)
+		if !block.ExpiresAt.IsZero() {
+			text += ", " + r.locale.T(i18n.TimeLeftText, i18n.Args{"duration": r.locale.Duration(time.Until(block.ExpiresAt))})
+		}
+		if block.Snippet != "" {
+			text += fmt.Sprintf("\n«%s»", block.Snippet)
+		}
+
+		callbackData, err := callbacks.Encode(blockedUnblockData{
+			BlockedUUID: block.BlockedUUID,
+			Page:        page,
+			Menu:        inMenu,
+		})
+		if err != nil {
+			return "", gotgbot.InlineKeyboardMarkup{}, err
+		}
+		buttons = append(buttons, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         buttonText,
+				CallbackData: callbackData,
+			},
+		})
+	}
+
+	var navigation []gotgbot.InlineKeyboardButton
+	if page > 0 {
+		callbackData, err := callbacks.Encode(blockedPageData{Page: page - 1, Menu: inMenu})
+		if err != nil {
+			return "", gotgbot.InlineKeyboardMarkup{}, err
+		}
+		navigation = append(navigation, gotgbot.InlineKeyboardButton{
+			Text:         r.locale.T(i18n.PreviousButtonText),
+			CallbackData: callbackData,
+		})
+	}
+	if page < pages-1 {
+		callbackData, err := callbacks.Encode(blockedPageData{Page: page + 1, Menu: inMenu})
+		if err != nil {
+			return "", gotgbot.InlineKeyboardMarkup{}, err
+		}
+		navigation = append(navigation, gotgbot.InlineKeyboardButton{
+			Text:         r.locale.T(i18n.NextButtonText),
+			CallbackData: callbackData,
+		})
+	}
+	if len(navigation) > 0 {
+		buttons = append(buttons, navigation)
+	}
+	if backRow != nil {
+		buttons = append(buttons, backRow)
+	}
+
+	return text, gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons}, nil
+}
+
+// isMutedBy reports whether the receiver has muted the sender
+func (r *RequestContext) isMutedBy(receiver *users.User, sender *users.User) (bool, error) {
+	block, err := r.blockRepo.ReadBlock(receiver.UUID, sender.UUID)
+	if err != nil {
+		return false, err
+	}
+	return block != nil && block.IsMuted(), nil
+}
+
+// blockCheck looks up the blocks between the sender and the receiver in both directions.
+// Mutes and expired blocks do not count as blocks.
+func (r *RequestContext) blockCheck(sender *users.User, receiver *users.User) (BlockedBy, error) {
+	// The receiver may not have been active since blocks moved out of the user item
+	err := r.blockRepo.MigrateBlacklist(r.userRepo, receiver)
+	if err != nil {
+		return None, err
+	}
+
+	block, err := r.blockRepo.ReadBlock(sender.UUID, receiver.UUID)
+	if err != nil {
+		return None, err
+	}
+	if block != nil && !block.IsMuted() {
+		return Sender, nil
+	}
+
+	block, err = r.blockRepo.ReadBlock(receiver.UUID, sender.UUID)
+	if err != nil {
+		return None, err
+	}
+	if block != nil && !block.IsMuted() {
+		return Receiver, nil
 	}
-	return None
+	return None, nil
 }
@@ -0,0 +1,181 @@
+package common
+
+import (
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+)
+
+// Button names, the part of the callback data updates are routed by
+const (
+	replyButton          = "r"
+	blockButton          = "b"
+	unBlockButton        = "ub"
+	openButton           = "o"
+	blockedPageButton    = "bp"
+	blockedUnblockButton = "bu"
+	blockDurationButton  = "bd"
+	blockCancelButton    = "bc"
+	confirmDeleteButton  = "da"
+	deleteAccountButton  = "df"
+	cancelDeleteButton   = "dx"
+	setUsernameButton    = "u"
+	removeUsernameButton = "ru"
+	cancelUsernameButton = "cu"
+	setSlugButton        = "v"
+	removeSlugButton     = "rv"
+	cancelSlugButton     = "cv"
+	setTimezoneButton    = "z"
+	removeTimezoneButton = "rz"
+	cancelTimezoneButton = "cz"
+	setLanguageButton    = "l"
+	cancelLanguageButton = "lc"
+	settingsMenuButton   = "m"
+	closeMenuButton      = "mx"
+	sendDraftButton      = "sd"
+	discardDraftButton   = "dd"
+	undoSendButton       = "us"
+	startScheduleButton  = "ss"
+	schedulePickerButton = "sp"
+	cancelScheduleButton = "sx"
+)
+
+// replyData is carried by the reply and send message buttons of a conversation
+type replyData struct {
+	ContactUUID string `callback:"uuid"`
+	MessageID   int64
+}
+
+func (replyData) CallbackName() string { return replyButton }
+
+// blockData is carried by the block button of a conversation
+type blockData struct {
+	ContactUUID string `callback:"uuid"`
+	MessageID   int64
+}
+
+func (blockData) CallbackName() string { return blockButton }
+
+// unBlockData is carried by the unblock and unmute buttons of a conversation
+type unBlockData struct {
+	ContactUUID string `callback:"uuid"`
+	MessageID   int64
+}
+
+func (unBlockData) CallbackName() string { return unBlockButton }
+
+// blockDurationData is carried by the buttons of the block duration menu
+type blockDurationData struct {
+	ContactUUID string `callback:"uuid"`
+	MessageID   int64
+	Duration    string
+}
+
+func (blockDurationData) CallbackName() string { return blockDurationButton }
+
+// blockCancelData is carried by the cancel button of the block duration menu
+type blockCancelData struct {
+	ContactUUID string `callback:"uuid"`
+	MessageID   int64
+}
+
+func (blockCancelData) CallbackName() string { return blockCancelButton }
+
+// openData is carried by the open button of a new message notification
+type openData struct {
+	MessageUUID string `callback:"uuid"`
+}
+
+func (openData) CallbackName() string { return openButton }
+
+// legacyOpenData is carried by open buttons sent before message records existed
+type legacyOpenData struct {
+	SenderUUID      string `callback:"uuid"`
+	SenderMessageID int64
+}
+
+func (legacyOpenData) CallbackName() string { return openButton }
+
+// blockedPageData is carried by the navigation buttons of the blocked users list
+type blockedPageData struct {
+	Page int
+	// Menu is set when the list is opened from the settings menu, it gets a back button to the menu
+	Menu bool
+}
+
+func (blockedPageData) CallbackName() string { return blockedPageButton }
+
+// blockedUnblockData is carried by the unblock buttons of the blocked users list
+type blockedUnblockData struct {
+	BlockedUUID string `callback:"uuid"`
+	Page        int
+	Menu        bool
+}
+
+func (blockedUnblockData) CallbackName() string { return blockedUnblockButton }
+
+// languageData is carried by the buttons of the language menu
+type languageData struct {
+	Language i18n.Language
+}
+
+func (languageData) CallbackName() string { return setLanguageButton }
+
+// menuData is carried by the buttons of the settings menu
+type menuData struct {
+	Page string
+	// Action is run by the page before it is shown, empty for navigation buttons
+	Action string
+}
+
+func (menuData) CallbackName() string { return settingsMenuButton }
+
+// sendDraftData is carried by the send button of a message preview
+type sendDraftData struct {
+	MessageID int64
+}
+
+func (sendDraftData) CallbackName() string { return sendDraftButton }
+
+// discardDraftData is carried by the discard button of a message preview
+type discardDraftData struct {
+	MessageID int64
+}
+
+func (discardDraftData) CallbackName() string { return discardDraftButton }
+
+// undoSendData is carried by the undo button of a message waiting to be delivered
+type undoSendData struct {
+	JobUUID string `callback:"uuid"`
+}
+
+func (undoSendData) CallbackName() string { return undoSendButton }
+
+// Steps of the schedule picker
+const (
+	scheduleMonthStep  = "m"
+	scheduleDayStep    = "d"
+	scheduleHourStep   = "h"
+	scheduleMinuteStep = "t"
+	// scheduleNoopStep is carried by the labels and blanks of the picker
+	scheduleNoopStep = "-"
+)
+
+// schedulePickerData is carried by the buttons of the date and time picker of
+// a scheduled message, the date is in the time zone of the sender
+type schedulePickerData struct {
+	MessageID int64
+	Step      string
+	Year      int
+	Month     int
+	Day       int
+	Hour      int
+	Minute    int
+}
+
+func (schedulePickerData) CallbackName() string { return schedulePickerButton }
+
+// cancelScheduleData is carried by the cancel buttons of the scheduled messages list
+type cancelScheduleData struct {
+	JobUUID string `callback:"uuid"`
+}
+
+func (cancelScheduleData) CallbackName() string { return cancelScheduleButton }
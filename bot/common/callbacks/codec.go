@@ -0,0 +1,236 @@
+// Package callbacks encodes the typed payloads of inline keyboard buttons into
+// callback data and decodes them back.
+//
+// The exported fields of a payload are written in order after its callback
+// name as "name|<base64url>". Strings tagged `callback:"uuid"` take 16 bytes,
+// integers are varints and other strings are length prefixed. Buttons sent
+// before this encoding carry their fields as text separated by "|" and are
+// still decoded.
+package callbacks
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MaxDataLength is the size limit of callback data imposed by Telegram
+const MaxDataLength = 64
+
+const separator = "|"
+
+var (
+	// ErrTooLong is returned when an encoded payload doesn't fit in the callback data
+	ErrTooLong = errors.New("callback data is too long")
+	// ErrInvalid is returned when callback data can't be decoded into the payload,
+	// usually because the button was created by an older version of the bot
+	ErrInvalid = errors.New("invalid callback data")
+)
+
+// Payload is the typed data carried by an inline keyboard button
+type Payload interface {
+	// CallbackName is the part of the callback data the button is routed by
+	CallbackName() string
+}
+
+// Encode returns the callback data of the payload
+func Encode(p Payload) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(p))
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("unsupported callback payload: %T", p)
+	}
+
+	var buf []byte
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		var err error
+		buf, err = appendField(buf, field, v.Field(i))
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s of %T: %w", field.Name, p, err)
+		}
+	}
+
+	data := p.CallbackName()
+	if len(buf) > 0 {
+		data += separator + base64.RawURLEncoding.EncodeToString(buf)
+	}
+	if len(data) > MaxDataLength {
+		return "", fmt.Errorf("%w: %T takes %d bytes", ErrTooLong, p, len(data))
+	}
+	return data, nil
+}
+
+// Decode reads the callback data into the payload, which must be a pointer to a struct
+func Decode(data string, p Payload) error {
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported callback payload: %T", p)
+	}
+	v = v.Elem()
+
+	name, fields, _ := strings.Cut(data, separator)
+	if name != p.CallbackName() {
+		return fmt.Errorf("%w: %s", ErrInvalid, data)
+	}
+
+	if decodeBinary(fields, v) != nil && decodeText(fields, v) != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, data)
+	}
+	return nil
+}
+
+func appendField(buf []byte, field reflect.StructField, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if field.Tag.Get("callback") == "uuid" {
+			id, err := uuid.Parse(v.String())
+			if err != nil {
+				return nil, err
+			}
+			return append(buf, id[:]...), nil
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(v.String())))
+		return append(buf, v.String()...), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.AppendUvarint(buf, v.Uint()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	default:
+		return nil, fmt.Errorf("unsupported field type: %s", v.Type())
+	}
+}
+
+func decodeBinary(fields string, v reflect.Value) error {
+	buf, err := base64.RawURLEncoding.DecodeString(fields)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		buf, err = readField(buf, field, v.Field(i))
+		if err != nil {
+			return err
+		}
+	}
+	if len(buf) > 0 {
+		return errors.New("unexpected trailing bytes")
+	}
+	return nil
+}
+
+func readField(buf []byte, field reflect.StructField, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		if field.Tag.Get("callback") == "uuid" {
+			if len(buf) < len(uuid.UUID{}) {
+				return nil, errors.New("short uuid")
+			}
+			id, _ := uuid.FromBytes(buf[:len(uuid.UUID{})])
+			v.SetString(id.String())
+			return buf[len(uuid.UUID{}):], nil
+		}
+		length, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < length {
+			return nil, errors.New("short string")
+		}
+		v.SetString(string(buf[n : n+int(length)]))
+		return buf[n+int(length):], nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, n := binary.Varint(buf)
+		if n <= 0 || v.OverflowInt(value) {
+			return nil, errors.New("invalid integer")
+		}
+		v.SetInt(value)
+		return buf[n:], nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, n := binary.Uvarint(buf)
+		if n <= 0 || v.OverflowUint(value) {
+			return nil, errors.New("invalid integer")
+		}
+		v.SetUint(value)
+		return buf[n:], nil
+	case reflect.Bool:
+		if len(buf) == 0 || buf[0] > 1 {
+			return nil, errors.New("invalid bool")
+		}
+		v.SetBool(buf[0] == 1)
+		return buf[1:], nil
+	default:
+		return nil, fmt.Errorf("unsupported field type: %s", v.Type())
+	}
+}
+
+// decodeText reads the fields of buttons created before the binary encoding
+func decodeText(fields string, v reflect.Value) error {
+	var exported []int
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).IsExported() {
+			exported = append(exported, i)
+		}
+	}
+
+	var values []string
+	if fields != "" {
+		values = strings.Split(fields, separator)
+	}
+	if len(values) != len(exported) {
+		return errors.New("unexpected number of fields")
+	}
+
+	for i, index := range exported {
+		field := v.Type().Field(index)
+		value := values[i]
+		fv := v.Field(index)
+		switch fv.Kind() {
+		case reflect.String:
+			if field.Tag.Get("callback") == "uuid" {
+				id, err := uuid.Parse(value)
+				if err != nil {
+					return err
+				}
+				value = id.String()
+			}
+			fv.SetString(value)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+			if err != nil {
+				return err
+			}
+			fv.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+			if err != nil {
+				return err
+			}
+			fv.SetUint(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			fv.SetBool(b)
+		default:
+			return fmt.Errorf("unsupported field type: %s", fv.Type())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package callbacks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testPayload struct {
+	UserUUID  string `callback:"uuid"`
+	MessageID int64
+	Code      string
+	Page      int
+	Muted     bool
+}
+
+func (testPayload) CallbackName() string { return "t" }
+
+type emptyPayload struct{}
+
+func (emptyPayload) CallbackName() string { return "e" }
+
+type longPayload struct {
+	Text string
+}
+
+func (longPayload) CallbackName() string { return "x" }
+
+func TestRoundTrip(t *testing.T) {
+	want := testPayload{
+		UserUUID:  "4f9a1c1e-8f3b-4a8e-9b8e-2f1f0f6d8c11",
+		MessageID: 1234567890,
+		Code:      "fa_IR",
+		Page:      -1,
+		Muted:     true,
+	}
+
+	data, err := Encode(want)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.HasPrefix(data, "t|") || len(data) > MaxDataLength {
+		t.Fatalf("Encode() = %q", data)
+	}
+
+	var got testPayload
+	if err := Decode(data, &got); err != nil {
+		t.Fatalf("Decode(%q) error = %v", data, err)
+	}
+	if got != want {
+		t.Errorf("Decode(%q) = %+v, want %+v", data, got, want)
+	}
+}
+
+func TestEmptyPayload(t *testing.T) {
+	data, err := Encode(emptyPayload{})
+	if err != nil || data != "e" {
+		t.Fatalf("Encode() = %q, %v", data, err)
+	}
+	if err := Decode("e", &emptyPayload{}); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	_, err := Encode(longPayload{Text: strings.Repeat("a", MaxDataLength)})
+	if !errors.Is(err, ErrTooLong) {
+		t.Errorf("Encode() error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	var got testPayload
+	err := Decode("t|4f9a1c1e-8f3b-4a8e-9b8e-2f1f0f6d8c11|42|en_US|3|false", &got)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := testPayload{
+		UserUUID:  "4f9a1c1e-8f3b-4a8e-9b8e-2f1f0f6d8c11",
+		MessageID: 42,
+		Code:      "en_US",
+		Page:      3,
+	}
+	if got != want {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"x|AAAA",
+		"t",
+		"t|!!!",
+		"t|not-a-uuid|42|en_US|3|false",
+		"t|4f9a1c1e-8f3b-4a8e-9b8e-2f1f0f6d8c11|42",
+		"e|AAAA",
+	}
+
+	for _, data := range tests {
+		var err error
+		if strings.HasPrefix(data, "e") {
+			err = Decode(data, &emptyPayload{})
+		} else {
+			err = Decode(data, &testPayload{})
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Decode(%q) error = %v, want ErrInvalid", data, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+)
+
+// commandMenu lists the command routes with a description in the language of
+// the localizer, the admin commands only if admin is set
+func commandMenu(locale i18n.Localizer, admin bool) []gotgbot.BotCommand {
+	var commands []gotgbot.BotCommand
+	for _, rt := range routes {
+		if rt.command == "" || rt.description == "" || (rt.admin && !admin) {
+			continue
+		}
+		commands = append(commands, gotgbot.BotCommand{
+			Command:     rt.command,
+			Description: locale.T(rt.description),
+		})
+	}
+	return commands
+}
+
+// commandScope is a group of chats sharing a command menu
+type commandScope struct {
+	scope gotgbot.BotCommandScope
+	admin bool
+}
+
+// SyncCommands publishes the command menu of every supported language to
+// Telegram, for every client language code the language serves. The users
+// whose client language isn't supported get the menu in the default language.
+// The private chats of the admins get the menus with the admin commands.
+func SyncCommands(b *gotgbot.Bot) error {
+	scopes := []commandScope{{scope: gotgbot.BotCommandScopeDefault{}}}
+	for _, id := range adminUserIDs {
+		scopes = append(scopes, commandScope{scope: gotgbot.BotCommandScopeChat{ChatId: id}, admin: true})
+	}
+
+	for _, s := range scopes {
+		// An empty language code sets the menu of the languages without one of their own
+		_, err := b.SetMyCommands(commandMenu(i18n.NewLocalizer("", ""), s.admin), &gotgbot.SetMyCommandsOpts{
+			Scope: s.scope,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set the default commands: %w", err)
+		}
+
+		for _, language := range i18n.Languages() {
+			commands := commandMenu(i18n.NewLocalizer(language.Code, ""), s.admin)
+			for _, alias := range language.Aliases {
+				_, err = b.SetMyCommands(commands, &gotgbot.SetMyCommandsOpts{
+					Scope:        s.scope,
+					LanguageCode: alias,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to set the %s commands: %w", language.Code, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RequestContext) syncCommands(b *gotgbot.Bot, ctx *ext.Context) error {
+	err := SyncCommands(b)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.CommandsSyncedText, i18n.Args{"count": len(i18n.Languages())}), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send commands sync result: %w", err)
+	}
+	return nil
+}
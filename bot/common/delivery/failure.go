@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"errors"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Failure is what a failed request to a user's chat means for reaching them later
+type Failure int
+
+const (
+	// Unknown can't be told apart from a passing problem of Telegram or the network
+	Unknown Failure = iota
+	// BotBlocked means the user blocked the bot or deleted their Telegram account
+	BotBlocked
+	// ChatNotFound means the chat of the user doesn't exist anymore
+	ChatNotFound
+	// RateLimited means the bot sent too much and has to wait before retrying
+	RateLimited
+)
+
+// Permanent reports whether the user can't be reached until they start the bot again
+func (f Failure) Permanent() bool {
+	return f == BotBlocked || f == ChatNotFound
+}
+
+// Classify tells what the error of a request to a user's chat means, along
+// with how long to wait before retrying a rate limited one
+func Classify(err error) (Failure, time.Duration) {
+	var telegramErr *gotgbot.TelegramError
+	if !errors.As(err, &telegramErr) {
+		return Unknown, 0
+	}
+
+	description := strings.ToLower(telegramErr.Description)
+	switch {
+	case telegramErr.Code == http.StatusForbidden:
+		// "bot was blocked by the user", "user is deactivated" and the like
+		return BotBlocked, 0
+	case telegramErr.Code == http.StatusBadRequest && (strings.Contains(description, "chat not found") || strings.Contains(description, "user not found")):
+		return ChatNotFound, 0
+	case telegramErr.Code == http.StatusTooManyRequests:
+		retryAfter := time.Second
+		if telegramErr.ResponseParams != nil && telegramErr.ResponseParams.RetryAfter > 0 {
+			retryAfter = time.Duration(telegramErr.ResponseParams.RetryAfter) * time.Second
+		}
+		return RateLimited, retryAfter
+	}
+	return Unknown, 0
+}
@@ -0,0 +1,57 @@
+package delivery
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		want       Failure
+		retryAfter time.Duration
+	}{
+		{"blocked", &gotgbot.TelegramError{Code: 403, Description: "Forbidden: bot was blocked by the user"}, BotBlocked, 0},
+		{"deactivated", &gotgbot.TelegramError{Code: 403, Description: "Forbidden: user is deactivated"}, BotBlocked, 0},
+		{"chat not found", &gotgbot.TelegramError{Code: 400, Description: "Bad Request: chat not found"}, ChatNotFound, 0},
+		{"user not found", &gotgbot.TelegramError{Code: 400, Description: "Bad Request: USER NOT FOUND"}, ChatNotFound, 0},
+		{"other bad request", &gotgbot.TelegramError{Code: 400, Description: "Bad Request: message is too long"}, Unknown, 0},
+		{"rate limited", &gotgbot.TelegramError{
+			Code:           429,
+			Description:    "Too Many Requests: retry after 7",
+			ResponseParams: &gotgbot.ResponseParameters{RetryAfter: 7},
+		}, RateLimited, 7 * time.Second},
+		{"rate limited without retry after", &gotgbot.TelegramError{Code: 429, Description: "Too Many Requests"}, RateLimited, time.Second},
+		{"server error", &gotgbot.TelegramError{Code: 502, Description: "Bad Gateway"}, Unknown, 0},
+		{"wrapped", fmt.Errorf("failed to send message: %w", &gotgbot.TelegramError{Code: 403}), BotBlocked, 0},
+		{"network", errors.New("connection reset by peer"), Unknown, 0},
+	}
+	for _, tt := range tests {
+		got, retryAfter := Classify(tt.err)
+		if got != tt.want || retryAfter != tt.retryAfter {
+			t.Errorf("%s: Classify() = %v, %v, want %v, %v", tt.name, got, retryAfter, tt.want, tt.retryAfter)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	tests := []struct {
+		failure Failure
+		want    bool
+	}{
+		{Unknown, false},
+		{BotBlocked, true},
+		{ChatNotFound, true},
+		{RateLimited, false},
+	}
+	for _, tt := range tests {
+		if got := tt.failure.Permanent(); got != tt.want {
+			t.Errorf("%v.Permanent() = %v, want %v", tt.failure, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"time"
+)
+
+// exportData is the personal data export of a user, only the blocks created by
+// the user are included since the blocks of other users belong to them
+type exportData struct {
+	ExportedAt time.Time       `json:"exported_at"`
+	User       exportUser      `json:"user"`
+	Settings   exportSettings  `json:"settings"`
+	Links      []string        `json:"links"`
+	Blocks     []exportBlock   `json:"blocks"`
+	Messages   []exportMessage `json:"messages"`
+	Scheduled  []exportPending `json:"scheduled_messages"`
+	Queued     []exportPending `json:"queued_messages"`
+}
+
+type exportUser struct {
+	UUID           string          `json:"uuid"`
+	UserID         int64           `json:"telegram_user_id"`
+	Username       string          `json:"username,omitempty"`
+	State          users.State     `json:"state"`
+	StateData      json.RawMessage `json:"state_data,omitempty"`
+	StateExpiresAt *time.Time      `json:"state_expires_at,omitempty"`
+	Inactive       bool            `json:"inactive"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type exportSettings struct {
+	Language         i18n.Language `json:"language,omitempty"`
+	Timezone         string        `json:"timezone,omitempty"`
+	SilentMessages   bool          `json:"silent_messages"`
+	ConfirmSending   bool          `json:"confirm_sending"`
+	SendDelay        int           `json:"send_delay,omitempty"`
+	HideReadReceipts bool          `json:"hide_read_receipts"`
+}
+
+type exportBlock struct {
+	BlockedUUID string            `json:"blocked_uuid"`
+	Label       int32             `json:"label"`
+	Mode        users.BlockMode   `json:"mode,omitempty"`
+	Reason      users.BlockReason `json:"reason,omitempty"`
+	Snippet     string            `json:"snippet,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
+}
+
+// exportMessage only carries the metadata, the message contents are never stored
+type exportMessage struct {
+	UUID            string     `json:"uuid"`
+	Direction       string     `json:"direction"`
+	SenderMessageID int64      `json:"sender_message_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	OpenedAt        *time.Time `json:"opened_at,omitempty"`
+}
+
+// exportPending is a message not delivered yet, waiting for the time its
+// sender scheduled it at or for the undo window of its sender to be over
+type exportPending struct {
+	UUID            string    `json:"uuid"`
+	SenderMessageID int64     `json:"sender_message_id"`
+	DueAt           time.Time `json:"due_at"`
+}
+
+func (r *RequestContext) exportUserData(b *gotgbot.Bot, ctx *ext.Context) error {
+	data, err := r.collectExportData(b)
+	if err != nil {
+		return fmt.Errorf("failed to collect export data: %w", err)
+	}
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export data: %w", err)
+	}
+
+	username := r.user.Username
+	if username == "" {
+		username = r.locale.T(i18n.NoneText)
+	}
+	language := string(r.user.Language)
+	if language == "" {
+		language = r.locale.T(i18n.NoneText)
+	}
+	summary := r.locale.T(i18n.ExportSummaryText, i18n.Args{
+		"id":       r.user.UUID,
+		"username": r.locale.Isolate(username),
+		"language": language,
+		"joined":   r.locale.Date(r.user.CreatedAt),
+		"links":    len(data.Links),
+		"blocks":   len(data.Blocks),
+		"messages": len(data.Messages),
+	})
+	_, err = ctx.EffectiveMessage.Reply(b, summary, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send export summary: %w", err)
+	}
+
+	_, err = b.SendDocument(ctx.EffectiveChat.Id, gotgbot.NamedFile{
+		File:     bytes.NewReader(content),
+		FileName: fmt.Sprintf("export-%s.json", time.Now().Format(time.DateOnly)),
+	}, &gotgbot.SendDocumentOpts{
+		Caption: r.locale.T(i18n.ExportFileNoteText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send export file: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RequestContext) collectExportData(b *gotgbot.Bot) (*exportData, error) {
+	links, err := userLinks(b, r.user)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := r.blockRepo.ReadBlocks(r.user)
+	if err != nil {
+		return nil, err
+	}
+	exportBlocks := make([]exportBlock, 0, len(blocks))
+	for _, block := range blocks {
+		eb := exportBlock{
+			BlockedUUID: block.BlockedUUID,
+			Label:       block.Label,
+			Mode:        block.Mode,
+			Reason:      block.Reason,
+			Snippet:     block.Snippet,
+			CreatedAt:   block.CreatedAt,
+		}
+		if !block.ExpiresAt.IsZero() {
+			expiresAt := block.ExpiresAt
+			eb.ExpiresAt = &expiresAt
+		}
+		exportBlocks = append(exportBlocks, eb)
+	}
+
+	messages, err := r.messageRepo.ReadUserMessages(r.user)
+	if err != nil {
+		return nil, err
+	}
+	exportMessages := make([]exportMessage, 0, len(messages))
+	for _, message := range messages {
+		em := exportMessage{
+			UUID:      message.UUID,
+			Direction: "received",
+			CreatedAt: message.CreatedAt,
+		}
+		// The sender's message ID only identifies a message in the sender's own chat
+		if message.SenderUUID == r.user.UUID {
+			em.Direction = "sent"
+			em.SenderMessageID = message.SenderMessageID
+		}
+		if !message.OpenedAt.IsZero() {
+			openedAt := message.OpenedAt
+			em.OpenedAt = &openedAt
+		}
+		exportMessages = append(exportMessages, em)
+	}
+
+	scheduled, err := r.pendingExportMessages(users.ScheduledMessageJob)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := r.pendingExportMessages(users.DeliverMessageJob)
+	if err != nil {
+		return nil, err
+	}
+
+	user := exportUser{
+		UUID:      r.user.UUID,
+		UserID:    r.user.UserID,
+		Username:  r.user.Username,
+		State:     r.user.State,
+		Inactive:  r.user.Inactive,
+		CreatedAt: r.user.CreatedAt,
+	}
+	if r.user.StateData != "" {
+		user.StateData = json.RawMessage(r.user.StateData)
+	}
+	if !r.user.StateExpiresAt.IsZero() {
+		user.StateExpiresAt = &r.user.StateExpiresAt
+	}
+
+	return &exportData{
+		ExportedAt: time.Now(),
+		User:       user,
+		Settings: exportSettings{
+			Language:         r.user.Language,
+			Timezone:         r.user.Timezone,
+			SilentMessages:   r.user.SilentMessages,
+			ConfirmSending:   r.user.ConfirmSending,
+			SendDelay:        r.user.SendDelay,
+			HideReadReceipts: r.user.HideReadReceipts,
+		},
+		Links:     links.All(),
+		Blocks:    exportBlocks,
+		Messages:  exportMessages,
+		Scheduled: scheduled,
+		Queued:    queued,
+	}, nil
+}
+
+// pendingExportMessages returns the messages of the user waiting in jobs of the kind
+func (r *RequestContext) pendingExportMessages(kind users.JobKind) ([]exportPending, error) {
+	jobs, err := r.jobRepo.ReadOwnerJobs(r.user, kind)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]exportPending, 0, len(jobs))
+	for _, job := range jobs {
+		var payload deliveryPayload
+		err = job.DecodePayload(&payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode pending message: %w", err)
+		}
+		pending = append(pending, exportPending{
+			UUID:            job.UUID,
+			SenderMessageID: payload.MessageID,
+			DueAt:           job.DueAt,
+		})
+	}
+	return pending, nil
+}
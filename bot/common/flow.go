@@ -0,0 +1,105 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"time"
+)
+
+// flowStep is a step of a multi-step flow waiting for a message of the user.
+// While the user is in the state of the step, the payload of type P is stored
+// along the state and the messages of the user are validated and handled by
+// the step. The user leaves the step when its handler resets or moves the
+// state, when the step times out or with /cancel.
+type flowStep[P any] struct {
+	state users.State
+	// ttl is how long the step waits for the message
+	ttl time.Duration
+	// expired explains that a message arriving after the step timed out was
+	// not used
+	expired i18n.TextID
+	// prompt returns the text asking for the message, sent when the step starts
+	prompt func(r *RequestContext, payload P) string
+	// keyboard returns the buttons sent with the prompt, optional
+	keyboard func(r *RequestContext, payload P) ([][]gotgbot.InlineKeyboardButton, error)
+	// validate returns the text explaining why the message can't be accepted,
+	// or an empty text to accept it. The user stays in the step to try again.
+	validate func(r *RequestContext, msg *gotgbot.Message, payload P) string
+	handle   func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context, payload P) error
+}
+
+// start moves the user into the step and sends its prompt
+func (s flowStep[P]) start(r *RequestContext, b *gotgbot.Bot, chatID int64, payload P) error {
+	err := r.userRepo.SetState(r.user, s.state, payload, time.Now().Add(s.ttl))
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	if s.prompt != nil {
+		opts := &gotgbot.SendMessageOpts{}
+		if s.keyboard != nil {
+			buttons, err := s.keyboard(r, payload)
+			if err != nil {
+				return err
+			}
+			opts.ReplyMarkup = gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons}
+		}
+		_, err = b.SendMessage(chatID, s.prompt(r, payload), opts)
+		if err != nil {
+			return fmt.Errorf("failed to send prompt: %w", err)
+		}
+	}
+	return nil
+}
+
+// route returns the message route of the step
+func (s flowStep[P]) route() route {
+	return route{
+		states:  []users.State{s.state},
+		expired: s.expired,
+		handle: func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context) error {
+			var payload P
+			err := r.user.StatePayload(&payload)
+			if err != nil {
+				resetErr := r.userRepo.ResetUserState(r.user)
+				if resetErr != nil {
+					return resetErr
+				}
+				return fmt.Errorf("failed to read %s state payload: %w", s.state, err)
+			}
+
+			if s.validate != nil {
+				if rejection := s.validate(r, ctx.EffectiveMessage, payload); rejection != "" {
+					_, err = ctx.EffectiveMessage.Reply(b, rejection, nil)
+					if err != nil {
+						return fmt.Errorf("failed to send reply message: %w", err)
+					}
+					return nil
+				}
+			}
+
+			return s.handle(r, b, ctx, payload)
+		},
+	}
+}
+
+// cancel leaves the flow the user is in, whichever it is
+func (r *RequestContext) cancel(b *gotgbot.Bot, ctx *ext.Context) error {
+	text := r.locale.T(i18n.NothingToCancelText)
+	if r.user.State != users.Idle {
+		err := r.userRepo.ResetUserState(r.user)
+		if err != nil {
+			return err
+		}
+		text = r.locale.T(i18n.CancelledText)
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send cancel message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"strings"
+	"time"
+)
+
+// CalendarMonth is a month of the calendar of the language of a localizer
+type CalendarMonth struct {
+	Year  int
+	Month int
+}
+
+// AddMonths returns the month n months after the month, both calendars having 12 months a year
+func (m CalendarMonth) AddMonths(n int) CalendarMonth {
+	index := m.Year*12 + m.Month - 1 + n
+	return CalendarMonth{Year: index / 12, Month: index%12 + 1}
+}
+
+// Sub returns the number of months from o to the month
+func (m CalendarMonth) Sub(o CalendarMonth) int {
+	return (m.Year*12 + m.Month) - (o.Year*12 + o.Month)
+}
+
+func (l Localizer) calendar() Calendar {
+	info, _ := LookupLanguage(l.language)
+	return info.Calendar
+}
+
+// MonthOf returns the calendar month the time falls in, in the time zone of the localizer
+func (l Localizer) MonthOf(t time.Time) CalendarMonth {
+	year, month, _ := l.calendarDate(t)
+	return CalendarMonth{Year: year, Month: month}
+}
+
+// calendarDate returns the date of the time in the calendar and time zone of the localizer
+func (l Localizer) calendarDate(t time.Time) (year, month, day int) {
+	t = t.In(l.location)
+	if l.calendar() == Jalali {
+		return gregorianToJalali(t.Year(), int(t.Month()), t.Day())
+	}
+	return t.Year(), int(t.Month()), t.Day()
+}
+
+// MonthDays returns the start of every day of the calendar month in the time
+// zone of the localizer, nil for a month which doesn't exist
+func (l Localizer) MonthDays(m CalendarMonth) []time.Time {
+	if m.Month < 1 || m.Month > 12 {
+		return nil
+	}
+
+	var first, next time.Time
+	if l.calendar() == Jalali {
+		gy, gm, gd := jalaliToGregorian(m.Year, m.Month, 1)
+		first = time.Date(gy, time.Month(gm), gd, 0, 0, 0, 0, l.location)
+		following := m.AddMonths(1)
+		gy, gm, gd = jalaliToGregorian(following.Year, following.Month, 1)
+		next = time.Date(gy, time.Month(gm), gd, 0, 0, 0, 0, l.location)
+	} else {
+		first = time.Date(m.Year, time.Month(m.Month), 1, 0, 0, 0, 0, l.location)
+		next = first.AddDate(0, 1, 0)
+	}
+
+	var days []time.Time
+	for day := first; day.Before(next); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// MonthTitle names the calendar month and its year, like March 2024 or فروردین ۱۴۰۳
+func (l Localizer) MonthTitle(m CalendarMonth) string {
+	names := strings.Fields(l.T(CalendarMonthsText))
+	if m.Month < 1 || m.Month > len(names) {
+		return l.Number(int64(m.Year)) + "/" + l.Number(int64(m.Month))
+	}
+	return names[m.Month-1] + " " + l.Number(int64(m.Year))
+}
+
+// FirstWeekday returns the day weeks start on in the calendars of the language
+func (l Localizer) FirstWeekday() time.Weekday {
+	info, _ := LookupLanguage(l.language)
+	return info.FirstWeekday
+}
+
+// Weekdays returns the short names of the days of the week, starting on the first weekday of the language
+func (l Localizer) Weekdays() []string {
+	// The catalog lists them from Sunday on, in the order of time.Weekday
+	names := strings.Fields(l.T(CalendarWeekdaysText))
+	if len(names) != 7 {
+		return names
+	}
+	first := int(l.FirstWeekday())
+	return append(append([]string{}, names[first:]...), names[:first]...)
+}
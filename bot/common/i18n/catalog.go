@@ -0,0 +1,159 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalog holds the texts of every supported language. It is filled once
+// when the package loads and only read afterwards.
+var catalog = loadCatalog(os.Getenv("I18N_OVERRIDE_DIR"))
+
+// placeholderPattern matches the named placeholders of a text, like {username}
+var placeholderPattern = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// loadCatalog reads the embedded catalogs and applies the texts found in the
+// <language>.json files of the override directory on top of them. Override
+// texts that don't pass validation are ignored so a broken file can't take
+// the bot down.
+func loadCatalog(overrideDir string) map[Language]LocaleTexts {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read embedded locales: %s", err))
+	}
+
+	catalog := make(map[Language]LocaleTexts)
+	for _, entry := range entries {
+		language := Language(strings.TrimSuffix(entry.Name(), ".json"))
+		data, err := localeFiles.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("failed to read embedded locale %s: %s", language, err))
+		}
+		texts, err := parseLocale(data)
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse embedded locale %s: %s", language, err))
+		}
+		catalog[language] = texts
+	}
+
+	if overrideDir != "" {
+		for language, texts := range catalog {
+			applyOverride(catalog, language, texts, filepath.Join(overrideDir, string(language)+".json"))
+		}
+	}
+
+	return catalog
+}
+
+func applyOverride(catalog map[Language]LocaleTexts, language Language, texts LocaleTexts, path string) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Println("failed to read locale override:", err)
+		return
+	}
+	overrides, err := parseLocale(data)
+	if err != nil {
+		log.Printf("failed to parse locale override %s: %s", path, err)
+		return
+	}
+
+	reference := catalog[EnUS]
+	for id, text := range overrides {
+		referenceText, ok := reference[id]
+		if !ok {
+			log.Printf("ignoring unknown text %s in locale override %s", id, path)
+			continue
+		}
+		if problems := checkText(language, id, text, referenceText); len(problems) > 0 {
+			log.Printf("ignoring text %s in locale override %s: %s", id, path, strings.Join(problems, ", "))
+			continue
+		}
+		texts[id] = text
+	}
+}
+
+func parseLocale(data []byte) (LocaleTexts, error) {
+	var texts LocaleTexts
+	err := json.Unmarshal(data, &texts)
+	if err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// placeholders returns the names of the placeholders used by any form of the text
+func placeholders(text Text) []string {
+	var names []string
+	for _, form := range text {
+		for _, placeholder := range placeholderPattern.FindAllString(form, -1) {
+			names = append(names, placeholder[1:len(placeholder)-1])
+		}
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// checkText compares a translated text with its English reference. The
+// translation has to use the same placeholders, in any order, and have every
+// plural form of its language when the reference depends on a count.
+func checkText(language Language, id TextID, text Text, reference Text) []string {
+	var problems []string
+	if got, want := placeholders(text), placeholders(reference); !slices.Equal(got, want) {
+		problems = append(problems, fmt.Sprintf("%s: text %s has placeholders %v, want %v", language, id, got, want))
+	}
+	if reference.IsPlural() && text.IsPlural() {
+		for _, category := range pluralRules[language].categories {
+			if _, ok := text[category]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: text %s is missing the %s plural form", language, id, category))
+			}
+		}
+	}
+	return problems
+}
+
+// Validate compares every language of the catalog with English and reports
+// the missing texts, the texts English doesn't have and the texts whose
+// placeholders or plural forms don't match.
+func Validate(catalog map[Language]LocaleTexts) []string {
+	reference, ok := catalog[EnUS]
+	if !ok {
+		return []string{"missing the English catalog"}
+	}
+
+	var problems []string
+	for language, texts := range catalog {
+		if language == EnUS {
+			continue
+		}
+		for id, referenceText := range reference {
+			text, ok := texts[id]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing text %s", language, id))
+				continue
+			}
+			problems = append(problems, checkText(language, id, text, referenceText)...)
+		}
+		for id := range texts {
+			if _, ok := reference[id]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: extra text %s", language, id))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,194 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	// The tz database is embedded since the Lambda runtime doesn't ship one
+	_ "time/tzdata"
+)
+
+// localizeDigits replaces the ASCII digits of the string with the native digits of the language
+func localizeDigits(language Language, s string) string {
+	info, ok := LookupLanguage(language)
+	if !ok || info.Digits == "" {
+		return s
+	}
+	digits := []rune(info.Digits)
+	var builder strings.Builder
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			c = digits[c-'0']
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+// Number writes the number with the digits of the language
+func (l Localizer) Number(n int64) string {
+	return localizeDigits(l.language, strconv.FormatInt(n, 10))
+}
+
+// Isolate keeps user chosen text like a username or a link from reordering
+// the right to left text of the localizer it is embedded in
+func (l Localizer) Isolate(s string) string {
+	if info, _ := LookupLanguage(l.language); !info.RTL || s == "" {
+		return s
+	}
+	// First strong isolate and pop directional isolate
+	return "\u2068" + s + "\u2069"
+}
+
+// Date writes the date of the time in the time zone, calendar and digits of
+// the localizer, like 2024-03-20 or ۱۴۰۳/۰۱/۰۱
+func (l Localizer) Date(t time.Time) string {
+	t = t.In(l.location)
+	var date string
+	if info, _ := LookupLanguage(l.language); info.Calendar == Jalali {
+		year, month, day := gregorianToJalali(t.Year(), int(t.Month()), t.Day())
+		date = fmt.Sprintf("%04d/%02d/%02d", year, month, day)
+	} else {
+		date = t.Format(time.DateOnly)
+	}
+	return localizeDigits(l.language, date)
+}
+
+// DateTime writes the date and the time of day of the time like Date does
+func (l Localizer) DateTime(t time.Time) string {
+	return l.Date(t) + " " + localizeDigits(l.language, t.In(l.location).Format("15:04"))
+}
+
+// Clock writes a time of day like 09:30 with the digits of the language
+func (l Localizer) Clock(hour, minute int) string {
+	return localizeDigits(l.language, fmt.Sprintf("%02d:%02d", hour, minute))
+}
+
+// TimeAgo describes how long ago the given time was
+func (l Localizer) TimeAgo(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return l.T(JustNowText)
+	case elapsed < time.Hour:
+		return l.T(MinutesAgoText, Args{"count": int(elapsed.Minutes())})
+	case elapsed < 24*time.Hour:
+		return l.T(HoursAgoText, Args{"count": int(elapsed.Hours())})
+	default:
+		return l.T(DaysAgoText, Args{"count": int(elapsed.Hours() / 24)})
+	}
+}
+
+// Duration describes a duration in its largest whole unit
+func (l Localizer) Duration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return l.T(SecondsText, Args{"count": int(d.Seconds())})
+	case d < time.Hour:
+		return l.T(MinutesText, Args{"count": max(1, int(d.Minutes()))})
+	case d < 24*time.Hour:
+		return l.T(HoursText, Args{"count": int(d.Hours())})
+	default:
+		return l.T(DaysText, Args{"count": int(d.Hours() / 24)})
+	}
+}
+
+// gregorianToJalali converts a Gregorian date to the Solar Hijri calendar
+// using the arithmetic 33 year cycle, which matches the official calendar for
+// the years the bot deals with.
+func gregorianToJalali(gy, gm, gd int) (jy, jm, jd int) {
+	daysBeforeMonth := [...]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+	leapYear := gy
+	if gm > 2 {
+		leapYear = gy + 1
+	}
+	days := 355666 + 365*gy + (leapYear+3)/4 - (leapYear+99)/100 + (leapYear+399)/400 + gd + daysBeforeMonth[gm-1]
+
+	jy = -1595 + 33*(days/12053)
+	days %= 12053
+	jy += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		jy += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+
+	// The first six months have 31 days, the next five 30 and the last 29 or 30
+	if days < 186 {
+		return jy, 1 + days/31, 1 + days%31
+	}
+	return jy, 7 + (days-186)/30, 1 + (days-186)%30
+}
+
+// jalaliToGregorian converts a Solar Hijri date to the Gregorian calendar,
+// the inverse of gregorianToJalali
+func jalaliToGregorian(jy, jm, jd int) (gy, gm, gd int) {
+	jy += 1595
+	days := -355668 + 365*jy + (jy/33)*8 + (jy%33+3)/4 + jd
+	if jm < 7 {
+		days += (jm - 1) * 31
+	} else {
+		days += (jm-7)*30 + 186
+	}
+
+	gy = 400 * (days / 146097)
+	days %= 146097
+	if days > 36524 {
+		days--
+		gy += 100 * (days / 36524)
+		days %= 36524
+		if days >= 365 {
+			days++
+		}
+	}
+	gy += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		gy += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+
+	gd = days + 1
+	monthDays := [...]int{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+	if (gy%4 == 0 && gy%100 != 0) || gy%400 == 0 {
+		monthDays[1] = 29
+	}
+	for gm = 1; gm < 12 && gd > monthDays[gm-1]; gm++ {
+		gd -= monthDays[gm-1]
+	}
+	return gy, gm, gd
+}
+
+// offsetPattern matches a time zone given as an offset from UTC, like +3:30, UTC-5 or GMT+0330
+var offsetPattern = regexp.MustCompile(`^(?:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// LoadTimezone returns the time zone with the given tz database name, like
+// Asia/Tehran, or offset from UTC, like +03:30. The String of the returned
+// location is its canonical name to store.
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if match := offsetPattern.FindStringSubmatch(strings.ToUpper(name)); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes, _ := strconv.Atoi(match[3])
+		if hours > 14 || minutes >= 60 {
+			return nil, fmt.Errorf("invalid time zone offset: %s", name)
+		}
+		offset := hours*3600 + minutes*60
+		if match[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(fmt.Sprintf("%s%02d:%02d", match[1], hours, minutes), offset), nil
+	}
+
+	// An empty name and Local would load the zone of the server
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("invalid time zone: %q", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone: %w", err)
+	}
+	return location, nil
+}
@@ -1,75 +1,331 @@
 package i18n
 
 import (
-	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
-	"strings"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
-// TestCompleteTranslations ensures that each language has all required text IDs translated.
-func TestCompleteTranslations(t *testing.T) {
-	requiredTextIDs, err := getTextsList()
+// TestCatalog ensures that every language translates exactly the English texts with the same placeholders.
+func TestCatalog(t *testing.T) {
+	if _, ok := catalog[FaIR]; !ok {
+		t.Errorf("locale for language '%s' was not loaded", FaIR)
+	}
+	for _, problem := range Validate(catalog) {
+		t.Error(problem)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	problems := Validate(map[Language]LocaleTexts{
+		EnUS: {
+			"A": {Other: "Hello {name}"},
+			"B": {Other: "Bye"},
+			"D": {One: "{count} day", Other: "{count} days"},
+			"E": {Other: "{name} has {count} links"},
+		},
+		FaIR: {
+			"A": {Other: "سلام"},
+			"C": {Other: "extra"},
+			"D": {Few: "{count} روز", Other: "{count} روز"},
+			"E": {Other: "{count} لینک برای {name}"},
+		},
+	})
+
+	want := []string{
+		"fa_IR: extra text C",
+		"fa_IR: missing text B",
+		"fa_IR: text A has placeholders [], want [name]",
+		"fa_IR: text D is missing the one plural form",
+	}
+	if !slices.Equal(problems, want) {
+		t.Errorf("Validate() = %q, want %q", problems, want)
+	}
+}
+
+func TestLoadCatalogOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{
+  "StartMessageText": "Hi!",
+  "UsernameHasBeenSetText": "wrong {name}",
+  "UnknownText": "ignored"
+}`
+	err := os.WriteFile(filepath.Join(dir, "en_US.json"), []byte(override), 0o644)
 	if err != nil {
-		t.Errorf("Error reading the text identifers list: %s", err)
+		t.Fatal(err)
+	}
+
+	loaded := loadCatalog(dir)
+	if got := loaded[EnUS][StartMessageText][Other]; got != "Hi!" {
+		t.Errorf("overridden text = %q, want %q", got, "Hi!")
+	}
+	if got := loaded[EnUS][UsernameHasBeenSetText][Other]; got != catalog[EnUS][UsernameHasBeenSetText][Other] {
+		t.Errorf("text with mismatched placeholders was applied: %q", got)
+	}
+	if _, ok := loaded[EnUS]["UnknownText"]; ok {
+		t.Error("unknown text was applied")
 	}
-	languages := []Language{EnUS, FaIR}
+}
+
+func TestNewLocalizer(t *testing.T) {
+	defer func(language Language) { defaultLanguage = language }(defaultLanguage)
 
-	for _, lang := range languages {
-		// Ensure the locale is loaded for testing
-		if _, ok := locales[lang]; !ok {
-			locales[lang] = loadLanguage(lang)
+	tests := []struct {
+		userLanguage    Language
+		clientLanguage  string
+		defaultLanguage Language
+		want            Language
+	}{
+		{FaIR, "en", EnUS, FaIR},
+		{"", "fa", EnUS, FaIR},
+		{"", "xx", FaIR, FaIR},
+		{"", "de", FaIR, DeDE},
+		{"", "pt-br", RuRU, RuRU},
+		{"", "ar-EG", EnUS, ArSA},
+		{"", "", "", EnUS},
+		{"xx_XX", "xx", "yy_YY", EnUS},
+	}
+
+	for _, test := range tests {
+		defaultLanguage = test.defaultLanguage
+		got := NewLocalizer(test.userLanguage, test.clientLanguage).Language()
+		if got != test.want {
+			t.Errorf("NewLocalizer(%q, %q) with default %q = %q, want %q", test.userLanguage, test.clientLanguage, test.defaultLanguage, got, test.want)
 		}
+	}
+}
 
-		texts, ok := locales[lang]
-		if !ok {
-			t.Errorf("locale for language '%s' was not loaded", lang)
-			continue
+func TestLocalizerNamedPlaceholders(t *testing.T) {
+	l := NewLocalizer(EnUS, "")
+	if got, want := l.T(UsernameHasBeenSetText, Args{"username": "john"}), "Username has been set: john"; got != want {
+		t.Errorf("T() = %q, want %q", got, want)
+	}
+}
+
+func TestLocalizerPlurals(t *testing.T) {
+	tests := []struct {
+		language Language
+		count    int
+		want     string
+	}{
+		{EnUS, 1, "1 day ago"},
+		{EnUS, 0, "0 days ago"},
+		{EnUS, 5, "5 days ago"},
+		{FaIR, 1, "۱ روز پیش"},
+		{FaIR, 5, "۵ روز پیش"},
+		{RuRU, 1, "1 день назад"},
+		{RuRU, 3, "3 дня назад"},
+		{RuRU, 11, "11 дней назад"},
+		{RuRU, 21, "21 день назад"},
+		{ArSA, 2, "منذ يومين"},
+		{ArSA, 7, "منذ ٧ أيام"},
+		{ArSA, 15, "منذ ١٥ يوماً"},
+		{ArSA, 100, "منذ ١٠٠ يوم"},
+	}
+
+	for _, test := range tests {
+		got := NewLocalizer(test.language, "").T(DaysAgoText, Args{"count": test.count})
+		if got != test.want {
+			t.Errorf("T(%s, %d) = %q, want %q", test.language, test.count, got, test.want)
+		}
+	}
+}
+
+func TestLanguageRegistry(t *testing.T) {
+	for _, language := range Languages() {
+		if _, ok := catalog[language.Code]; !ok {
+			t.Errorf("language %s has no catalog", language.Code)
+		}
+		if _, ok := pluralRules[language.Code]; !ok {
+			t.Errorf("language %s has no plural rule", language.Code)
+		}
+	}
+	for language := range catalog {
+		if _, ok := LookupLanguage(language); !ok {
+			t.Errorf("catalog %s is not in the language registry", language)
 		}
+	}
+}
+
+func TestGregorianToJalali(t *testing.T) {
+	tests := []struct {
+		gy, gm, gd int
+		jy, jm, jd int
+	}{
+		{2023, 3, 21, 1402, 1, 1},
+		{2024, 3, 20, 1403, 1, 1},
+		{2025, 3, 20, 1403, 12, 30},
+		{2026, 10, 19, 1405, 7, 27},
+		{1979, 2, 11, 1357, 11, 22},
+	}
 
-		for _, id := range requiredTextIDs {
-			if _, exists := texts[id]; !exists {
-				t.Errorf("missing text '%s' for language '%s'", id, lang)
-			}
+	for _, test := range tests {
+		jy, jm, jd := gregorianToJalali(test.gy, test.gm, test.gd)
+		if jy != test.jy || jm != test.jm || jd != test.jd {
+			t.Errorf("gregorianToJalali(%d, %d, %d) = %d/%d/%d, want %d/%d/%d", test.gy, test.gm, test.gd, jy, jm, jd, test.jy, test.jm, test.jd)
 		}
 	}
 }
 
-func getTextsList() ([]TextID, error) {
-	filePath := "./translation.go"
+func TestJalaliToGregorian(t *testing.T) {
+	for day := time.Date(1979, 1, 1, 0, 0, 0, 0, time.UTC); day.Year() < 2040; day = day.AddDate(0, 0, 1) {
+		jy, jm, jd := gregorianToJalali(day.Year(), int(day.Month()), day.Day())
+		gy, gm, gd := jalaliToGregorian(jy, jm, jd)
+		if gy != day.Year() || gm != int(day.Month()) || gd != day.Day() {
+			t.Fatalf("jalaliToGregorian(%d, %d, %d) = %d-%d-%d, want %s", jy, jm, jd, gy, gm, gd, day.Format(time.DateOnly))
+		}
+	}
+}
 
-	// Create a new token file set
-	fset := token.NewFileSet()
+func TestLocalizerCalendar(t *testing.T) {
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	moment := time.Date(2024, 3, 19, 22, 0, 0, 0, time.UTC)
 
-	// Parse the file
-	node, err := parser.ParseFile(fset, filePath, nil, parser.AllErrors)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing file: %s", err)
-	}
-
-	var ids []TextID
-
-	// Use ast.Inspect to traverse the AST and find constants
-	ast.Inspect(node, func(n ast.Node) bool {
-		// Check for general declarations (var, const, type)
-		genDecl, ok := n.(*ast.GenDecl)
-		if ok && genDecl.Tok == token.CONST {
-			for _, spec := range genDecl.Specs {
-				// Assertion for ValueSpec since constants belong to this category
-				valSpec, ok := spec.(*ast.ValueSpec)
-				if ok {
-					for _, name := range valSpec.Names {
-						if strings.HasSuffix(name.Name, "Text") {
-							ids = append(ids, TextID(name.Name))
-						}
-					}
-				}
-			}
-		}
-		return true // Continue to traverse the AST
-	})
+	tests := []struct {
+		localizer Localizer
+		month     CalendarMonth
+		days      int
+		first     string
+		title     string
+		weekdays  string
+	}{
+		{NewLocalizer(EnUS, ""), CalendarMonth{2024, 3}, 31, "2024-03-01", "March 2024", "Su"},
+		{NewLocalizer(DeDE, "").In(tehran), CalendarMonth{2024, 3}, 31, "2024-03-01", "März 2024", "Mo"},
+		{NewLocalizer(FaIR, "").In(tehran), CalendarMonth{1403, 1}, 31, "2024-03-20", "فروردین ۱۴۰۳", "ش"},
+	}
+
+	for _, test := range tests {
+		l := test.localizer
+		if got := l.MonthOf(moment); got != test.month {
+			t.Errorf("MonthOf() in %s = %v, want %v", l.Language(), got, test.month)
+		}
+		days := l.MonthDays(test.month)
+		if len(days) != test.days || days[0].Format(time.DateOnly) != test.first {
+			t.Errorf("MonthDays(%v) in %s has %d days from %s, want %d from %s", test.month, l.Language(), len(days), days[0].Format(time.DateOnly), test.days, test.first)
+		}
+		if got := l.MonthTitle(test.month); got != test.title {
+			t.Errorf("MonthTitle(%v) in %s = %q, want %q", test.month, l.Language(), got, test.title)
+		}
+		if got := l.Weekdays(); len(got) != 7 || got[0] != test.weekdays {
+			t.Errorf("Weekdays() in %s = %q, want 7 starting with %q", l.Language(), got, test.weekdays)
+		}
+	}
+
+	// Esfand has 30 days in leap years of the Jalali calendar
+	fa := NewLocalizer(FaIR, "")
+	if got := len(fa.MonthDays(CalendarMonth{1403, 12})); got != 30 {
+		t.Errorf("Esfand 1403 has %d days, want 30", got)
+	}
+	if got := len(fa.MonthDays(CalendarMonth{1402, 12})); got != 29 {
+		t.Errorf("Esfand 1402 has %d days, want 29", got)
+	}
+	if got := fa.MonthDays(CalendarMonth{1403, 13}); got != nil {
+		t.Errorf("MonthDays() of month 13 = %v, want nil", got)
+	}
+	if got := (CalendarMonth{1403, 11}).AddMonths(3); got != (CalendarMonth{1404, 2}) {
+		t.Errorf("AddMonths(3) = %v, want 1404/2", got)
+	}
+}
+
+func TestLocalizerDates(t *testing.T) {
+	tehran := time.FixedZone("IRST", 3*3600+1800)
+	moment := time.Date(2024, 3, 19, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		localizer Localizer
+		date      string
+		dateTime  string
+	}{
+		{NewLocalizer(EnUS, ""), "2024-03-19", "2024-03-19 22:00"},
+		{NewLocalizer(EnUS, "").In(tehran), "2024-03-20", "2024-03-20 01:30"},
+		{NewLocalizer(FaIR, "").In(tehran), "۱۴۰۳/۰۱/۰۱", "۱۴۰۳/۰۱/۰۱ ۰۱:۳۰"},
+		{NewLocalizer(ArSA, ""), "٢٠٢٤-٠٣-١٩", "٢٠٢٤-٠٣-١٩ ٢٢:٠٠"},
+	}
+
+	for _, test := range tests {
+		if got := test.localizer.Date(moment); got != test.date {
+			t.Errorf("Date() in %s = %q, want %q", test.localizer.Language(), got, test.date)
+		}
+		if got := test.localizer.DateTime(moment); got != test.dateTime {
+			t.Errorf("DateTime() in %s = %q, want %q", test.localizer.Language(), got, test.dateTime)
+		}
+	}
+}
+
+func TestLocalizerNumbers(t *testing.T) {
+	if got, want := NewLocalizer(FaIR, "").Number(1403), "۱۴۰۳"; got != want {
+		t.Errorf("Number() = %q, want %q", got, want)
+	}
+	if got, want := NewLocalizer(ArSA, "").Clock(9, 5), "٠٩:٠٥"; got != want {
+		t.Errorf("Clock() = %q, want %q", got, want)
+	}
+	if got, want := NewLocalizer(EnUS, "").Number(1403), "1403"; got != want {
+		t.Errorf("Number() = %q, want %q", got, want)
+	}
+	if got, want := NewLocalizer(FaIR, "").T(BlockedUsersListText, Args{"page": 2, "pages": 10}), "کاربران بلاک شده (صفحه ۲ از ۱۰):"; got != want {
+		t.Errorf("T() = %q, want %q", got, want)
+	}
+}
+
+func TestLocalizerIsolate(t *testing.T) {
+	if got, want := NewLocalizer(FaIR, "").Isolate("bugfloyd"), "\u2068bugfloyd\u2069"; got != want {
+		t.Errorf("Isolate() = %q, want %q", got, want)
+	}
+	if got, want := NewLocalizer(EnUS, "").Isolate("bugfloyd"), "bugfloyd"; got != want {
+		t.Errorf("Isolate() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		offset int
+	}{
+		{"Asia/Tehran", "Asia/Tehran", 3*3600 + 1800},
+		{" Europe/Berlin ", "Europe/Berlin", 3600},
+		{"+03:30", "+03:30", 3*3600 + 1800},
+		{"utc-5", "-05:00", -5 * 3600},
+		{"GMT+0545", "+05:45", 5*3600 + 2700},
+		{"+0", "+00:00", 0},
+	}
+	winter := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range tests {
+		location, err := LoadTimezone(test.name)
+		if err != nil {
+			t.Errorf("LoadTimezone(%q) failed: %s", test.name, err)
+			continue
+		}
+		_, offset := winter.In(location).Zone()
+		if location.String() != test.want || offset != test.offset {
+			t.Errorf("LoadTimezone(%q) = %s with offset %d, want %s with offset %d", test.name, location, offset, test.want, test.offset)
+		}
+	}
 
-	return ids, nil
+	for _, name := range []string{"", "Local", "Mars/Olympus", "+15", "+03:75", "3:30"} {
+		if _, err := LoadTimezone(name); err == nil {
+			t.Errorf("LoadTimezone(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestLocalizerDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{30 * time.Second, "30 seconds"},
+		{90 * time.Second, "1 minute"},
+		{3 * time.Hour, "3 hours"},
+		{48 * time.Hour, "2 days"},
+	}
+
+	for _, test := range tests {
+		if got := NewLocalizer(EnUS, "").Duration(test.duration); got != test.want {
+			t.Errorf("Duration(%s) = %q, want %q", test.duration, got, test.want)
+		}
+	}
 }
@@ -0,0 +1,74 @@
+package i18n
+
+import (
+	"strings"
+	"time"
+)
+
+// LanguageInfo describes a supported language
+type LanguageInfo struct {
+	Code Language
+	// NativeName is the name of the language in itself, used in the language menu
+	NativeName string
+	// RTL reports whether the language is written right to left
+	RTL bool
+	// Aliases are the Telegram client language codes served in this language
+	Aliases []string
+	// Digits are the native digits from zero to nine, empty for Latin digits
+	Digits string
+	// Calendar is the calendar dates are shown in
+	Calendar Calendar
+	// FirstWeekday is the day weeks start on in calendars
+	FirstWeekday time.Weekday
+}
+
+// Calendar is a calendar system dates can be shown in
+type Calendar string
+
+const (
+	Gregorian Calendar = "gregorian"
+	// Jalali is the Solar Hijri calendar used in Iran
+	Jalali Calendar = "jalali"
+)
+
+// languages is the registry of supported languages in the order the language
+// menu lists them. Adding a language takes an entry here, a locales/<code>.json
+// catalog and a plural rule.
+var languages = []LanguageInfo{
+	{Code: EnUS, NativeName: "English", Aliases: []string{"en"}, FirstWeekday: time.Sunday},
+	{Code: FaIR, NativeName: "فارسی", RTL: true, Aliases: []string{"fa"}, Digits: "۰۱۲۳۴۵۶۷۸۹", Calendar: Jalali, FirstWeekday: time.Saturday},
+	{Code: ArSA, NativeName: "العربية", RTL: true, Aliases: []string{"ar"}, Digits: "٠١٢٣٤٥٦٧٨٩", FirstWeekday: time.Sunday},
+	{Code: TrTR, NativeName: "Türkçe", Aliases: []string{"tr"}, FirstWeekday: time.Monday},
+	{Code: RuRU, NativeName: "Русский", Aliases: []string{"ru"}, FirstWeekday: time.Monday},
+	{Code: DeDE, NativeName: "Deutsch", Aliases: []string{"de"}, FirstWeekday: time.Monday},
+}
+
+// Languages returns the supported languages in menu order
+func Languages() []LanguageInfo {
+	return languages
+}
+
+// LookupLanguage returns the registry entry of a supported language
+func LookupLanguage(code Language) (LanguageInfo, bool) {
+	for _, language := range languages {
+		if language.Code == code {
+			return language, true
+		}
+	}
+	return LanguageInfo{}, false
+}
+
+// clientLanguageOf returns the supported language serving a Telegram client
+// language code like "de" or "pt-br", or an empty language if there is none
+func clientLanguageOf(code string) Language {
+	code = strings.ToLower(code)
+	base, _, _ := strings.Cut(code, "-")
+	for _, language := range languages {
+		for _, alias := range language.Aliases {
+			if alias == code || alias == base {
+				return language.Code
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package i18n
+
+// PluralCategory is a CLDR plural category a count falls into
+type PluralCategory string
+
+const (
+	Zero  PluralCategory = "zero"
+	One   PluralCategory = "one"
+	Two   PluralCategory = "two"
+	Few   PluralCategory = "few"
+	Many  PluralCategory = "many"
+	Other PluralCategory = "other"
+)
+
+// pluralRule holds the CLDR cardinal plural rule of a language for integer counts
+type pluralRule struct {
+	// categories are the plural categories the language distinguishes
+	categories []PluralCategory
+	category   func(n int64) PluralCategory
+}
+
+var pluralRules = map[Language]pluralRule{
+	EnUS: {
+		categories: []PluralCategory{One, Other},
+		category: func(n int64) PluralCategory {
+			if n == 1 {
+				return One
+			}
+			return Other
+		},
+	},
+	FaIR: {
+		categories: []PluralCategory{One, Other},
+		category: func(n int64) PluralCategory {
+			if n == 0 || n == 1 {
+				return One
+			}
+			return Other
+		},
+	},
+	ArSA: {
+		categories: []PluralCategory{Zero, One, Two, Few, Many, Other},
+		category: func(n int64) PluralCategory {
+			switch {
+			case n == 0:
+				return Zero
+			case n == 1:
+				return One
+			case n == 2:
+				return Two
+			case n%100 >= 3 && n%100 <= 10:
+				return Few
+			case n%100 >= 11:
+				return Many
+			}
+			return Other
+		},
+	},
+	TrTR: {
+		categories: []PluralCategory{One, Other},
+		category: func(n int64) PluralCategory {
+			if n == 1 {
+				return One
+			}
+			return Other
+		},
+	},
+	RuRU: {
+		// Other is only used by fractions, which counts never are
+		categories: []PluralCategory{One, Few, Many, Other},
+		category: func(n int64) PluralCategory {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return One
+			case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+				return Few
+			}
+			return Many
+		},
+	},
+	DeDE: {
+		categories: []PluralCategory{One, Other},
+		category: func(n int64) PluralCategory {
+			if n == 1 {
+				return One
+			}
+			return Other
+		},
+	},
+}
+
+// pluralCategory returns the plural category of the count in the language
+func pluralCategory(language Language, n int64) PluralCategory {
+	rule, ok := pluralRules[language]
+	if !ok {
+		return Other
+	}
+	if n < 0 {
+		n = -n
+	}
+	return rule.category(n)
+}
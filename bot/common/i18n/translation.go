@@ -1,7 +1,11 @@
 package i18n
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 // TextID represents the keys for internationalized texts
@@ -49,6 +53,141 @@ const (
 	UsernameHasBeenSetText          TextID = "UsernameHasBeenSetText"
 	UsernameExistsText              TextID = "UsernameExistsText"
 	SameUsernameText                TextID = "SameUsernameText"
+	ReservedUsernameText            TextID = "ReservedUsernameText"
+	BannedUsernameText              TextID = "BannedUsernameText"
+	MixedScriptUsernameText         TextID = "MixedScriptUsernameText"
+	LookAlikeUsernameText           TextID = "LookAlikeUsernameText"
+	QuarantinedUsernameText         TextID = "QuarantinedUsernameText"
+	YourCurrentSlugText             TextID = "YourCurrentSlugText"
+	YouDontHaveASlugText            TextID = "YouDontHaveASlugText"
+	SlugExplanationText             TextID = "SlugExplanationText"
+	EnterANewSlugText               TextID = "EnterANewSlugText"
+	SettingSlugText                 TextID = "SettingSlugText"
+	SlugHasBeenSetText              TextID = "SlugHasBeenSetText"
+	SlugHasBeenRemovedText          TextID = "SlugHasBeenRemovedText"
+	InvalidSlugText                 TextID = "InvalidSlugText"
+	SlugExistsText                  TextID = "SlugExistsText"
+	SameSlugText                    TextID = "SameSlugText"
+	SlugNotAllowedText              TextID = "SlugNotAllowedText"
+	YourTimezoneText                TextID = "YourTimezoneText"
+	NoTimezoneText                  TextID = "NoTimezoneText"
+	TimezoneExplanationText         TextID = "TimezoneExplanationText"
+	SettingTimezoneText             TextID = "SettingTimezoneText"
+	InvalidTimezoneText             TextID = "InvalidTimezoneText"
+	TimezoneHasBeenSetText          TextID = "TimezoneHasBeenSetText"
+	TimezoneHasBeenRemovedText      TextID = "TimezoneHasBeenRemovedText"
+	UsernameChangeTooSoonText       TextID = "UsernameChangeTooSoonText"
+	NoBlockedUsersText              TextID = "NoBlockedUsersText"
+	BlockedUsersListText            TextID = "BlockedUsersListText"
+	AnonymousLabelText              TextID = "AnonymousLabelText"
+	BlockedAgoText                  TextID = "BlockedAgoText"
+	UnblockUserButtonText           TextID = "UnblockUserButtonText"
+	PreviousButtonText              TextID = "PreviousButtonText"
+	NextButtonText                  TextID = "NextButtonText"
+	JustNowText                     TextID = "JustNowText"
+	MinutesAgoText                  TextID = "MinutesAgoText"
+	HoursAgoText                    TextID = "HoursAgoText"
+	DaysAgoText                     TextID = "DaysAgoText"
+	ChooseBlockDurationText         TextID = "ChooseBlockDurationText"
+	BlockOneHourButtonText          TextID = "BlockOneHourButtonText"
+	BlockOneDayButtonText           TextID = "BlockOneDayButtonText"
+	BlockOneWeekButtonText          TextID = "BlockOneWeekButtonText"
+	BlockForeverButtonText          TextID = "BlockForeverButtonText"
+	MuteButtonText                  TextID = "MuteButtonText"
+	UnmuteButtonText                TextID = "UnmuteButtonText"
+	UserBlockedForText              TextID = "UserBlockedForText"
+	UserMutedText                   TextID = "UserMutedText"
+	UnmuteUserButtonText            TextID = "UnmuteUserButtonText"
+	MutedAgoText                    TextID = "MutedAgoText"
+	TimeLeftText                    TextID = "TimeLeftText"
+	MinutesText                     TextID = "MinutesText"
+	HoursText                       TextID = "HoursText"
+	DaysText                        TextID = "DaysText"
+	ExportSummaryText               TextID = "ExportSummaryText"
+	ExportFileNoteText              TextID = "ExportFileNoteText"
+	NoneText                        TextID = "NoneText"
+	MessageNoLongerAvailableText    TextID = "MessageNoLongerAvailableText"
+	ButtonExpiredText               TextID = "ButtonExpiredText"
+	DeleteAccountWarningText        TextID = "DeleteAccountWarningText"
+	DeleteAccountFinalWarningText   TextID = "DeleteAccountFinalWarningText"
+	DeleteAccountButtonText         TextID = "DeleteAccountButtonText"
+	DeleteForeverButtonText         TextID = "DeleteForeverButtonText"
+	AccountDeletedText              TextID = "AccountDeletedText"
+	StartCommandText                TextID = "StartCommandText"
+	InfoCommandText                 TextID = "InfoCommandText"
+	LinkCommandText                 TextID = "LinkCommandText"
+	UsernameCommandText             TextID = "UsernameCommandText"
+	SlugCommandText                 TextID = "SlugCommandText"
+	TimezoneCommandText             TextID = "TimezoneCommandText"
+	LanguageCommandText             TextID = "LanguageCommandText"
+	UnblockAllCommandText           TextID = "UnblockAllCommandText"
+	BlockedCommandText              TextID = "BlockedCommandText"
+	ExportCommandText               TextID = "ExportCommandText"
+	DeleteMeCommandText             TextID = "DeleteMeCommandText"
+	SyncCommandsCommandText         TextID = "SyncCommandsCommandText"
+	CommandsSyncedText              TextID = "CommandsSyncedText"
+	SettingsText                    TextID = "SettingsText"
+	SettingsCommandText             TextID = "SettingsCommandText"
+	UsernameSettingsButtonText      TextID = "UsernameSettingsButtonText"
+	LinksSettingsButtonText         TextID = "LinksSettingsButtonText"
+	LanguageSettingsButtonText      TextID = "LanguageSettingsButtonText"
+	TimezoneSettingsButtonText      TextID = "TimezoneSettingsButtonText"
+	NotificationsSettingsButtonText TextID = "NotificationsSettingsButtonText"
+	PrivacySettingsButtonText       TextID = "PrivacySettingsButtonText"
+	BlockedSettingsButtonText       TextID = "BlockedSettingsButtonText"
+	BackButtonText                  TextID = "BackButtonText"
+	CloseButtonText                 TextID = "CloseButtonText"
+	SetSlugButtonText               TextID = "SetSlugButtonText"
+	ChangeSlugButtonText            TextID = "ChangeSlugButtonText"
+	RemoveSlugButtonText            TextID = "RemoveSlugButtonText"
+	NotificationsSettingsText       TextID = "NotificationsSettingsText"
+	SilentMessagesButtonText        TextID = "SilentMessagesButtonText"
+	PrivacySettingsText             TextID = "PrivacySettingsText"
+	ReadReceiptsButtonText          TextID = "ReadReceiptsButtonText"
+	OnText                          TextID = "OnText"
+	OffText                         TextID = "OffText"
+	BlockedSettingsText             TextID = "BlockedSettingsText"
+	ShowBlockedListButtonText       TextID = "ShowBlockedListButtonText"
+	UnblockAllButtonText            TextID = "UnblockAllButtonText"
+	CancelCommandText               TextID = "CancelCommandText"
+	CancelledText                   TextID = "CancelledText"
+	NothingToCancelText             TextID = "NothingToCancelText"
+	SendingExpiredText              TextID = "SendingExpiredText"
+	StateExpiredText                TextID = "StateExpiredText"
+	SendingSettingsButtonText       TextID = "SendingSettingsButtonText"
+	SendingSettingsText             TextID = "SendingSettingsText"
+	ConfirmSendingButtonText        TextID = "ConfirmSendingButtonText"
+	SendPreviewText                 TextID = "SendPreviewText"
+	SendDraftButtonText             TextID = "SendDraftButtonText"
+	DiscardDraftButtonText          TextID = "DiscardDraftButtonText"
+	MessageSentText                 TextID = "MessageSentText"
+	DraftDiscardedText              TextID = "DraftDiscardedText"
+	SecondsText                     TextID = "SecondsText"
+	SendingInText                   TextID = "SendingInText"
+	UndoSendButtonText              TextID = "UndoSendButtonText"
+	TooLateToUndoText               TextID = "TooLateToUndoText"
+	MessageUnsentText               TextID = "MessageUnsentText"
+	ScheduleButtonText              TextID = "ScheduleButtonText"
+	WriteScheduledMessageText       TextID = "WriteScheduledMessageText"
+	PickScheduleDayText             TextID = "PickScheduleDayText"
+	PickScheduleTimeText            TextID = "PickScheduleTimeText"
+	CalendarWeekdaysText            TextID = "CalendarWeekdaysText"
+	SchedulePassedText              TextID = "SchedulePassedText"
+	ScheduledText                   TextID = "ScheduledText"
+	ScheduledCommandText            TextID = "ScheduledCommandText"
+	ScheduledMessagesText           TextID = "ScheduledMessagesText"
+	NoScheduledMessagesText         TextID = "NoScheduledMessagesText"
+	CancelScheduledButtonText       TextID = "CancelScheduledButtonText"
+	ReceiverUnreachableText         TextID = "ReceiverUnreachableText"
+	ReceiverInactiveText            TextID = "ReceiverInactiveText"
+	MessageNotDeliveredText         TextID = "MessageNotDeliveredText"
+	SetTimezoneButtonText           TextID = "SetTimezoneButtonText"
+	ChangeTimezoneButtonText        TextID = "ChangeTimezoneButtonText"
+	RemoveTimezoneButtonText        TextID = "RemoveTimezoneButtonText"
+	UnblockAllConfirmText           TextID = "UnblockAllConfirmText"
+	UnblockAllConfirmButtonText     TextID = "UnblockAllConfirmButtonText"
+	CalendarMonthsText              TextID = "CalendarMonthsText"
+	MessagePostponedText            TextID = "MessagePostponedText"
 )
 
 type Language string
@@ -56,80 +195,147 @@ type Language string
 const (
 	FaIR Language = "fa_IR"
 	EnUS Language = "en_US"
+	ArSA Language = "ar_SA"
+	TrTR Language = "tr_TR"
+	RuRU Language = "ru_RU"
+	DeDE Language = "de_DE"
 )
 
-// LocaleTexts maps Text IDs to their translated strings
-type LocaleTexts map[TextID]string
+// LocaleTexts maps Text IDs to their translated texts
+type LocaleTexts map[TextID]Text
 
-// Locales holds the loaded languages and their texts
-var (
-	locales       = make(map[Language]LocaleTexts)
-	currentLocale Language
-)
+// Text is a translated text. A text depending on a count has a form per plural
+// category of its language, any other text only has the Other form. Catalogs
+// write the latter as a plain string.
+type Text map[PluralCategory]string
 
-// SetLocale sets the current language for the application.
-func SetLocale(userLanguage Language, clientLanguage string) {
-	var language Language
-	if userLanguage != "" {
-		language = userLanguage
-	} else {
-		defaultLang := os.Getenv("DEFAULT_LANGUAGE")
-		if defaultLang != "" {
-			language = Language(defaultLang)
-		} else {
-			if clientLanguage == "fa" {
-				language = FaIR
-			} else if clientLanguage == "en" {
-				language = EnUS
-			} else {
-				language = EnUS
-			}
-		}
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		*t = Text{Other: text}
+		return nil
+	}
+	var forms map[PluralCategory]string
+	err := json.Unmarshal(data, &forms)
+	if err != nil {
+		return err
 	}
-	if _, ok := locales[language]; !ok {
-		locales[language] = loadLanguage(language)
+	if _, ok := forms[Other]; !ok {
+		return fmt.Errorf("plural text without the %s form", Other)
 	}
-	currentLocale = language
+	*t = forms
+	return nil
+}
+
+// IsPlural reports whether the text has forms for different counts
+func (t Text) IsPlural() bool {
+	return len(t) > 1
 }
 
-// loadLanguage is a helper function that loads translations for a given language.
-func loadLanguage(lang Language) LocaleTexts {
-	switch lang {
-	case EnUS:
-		return enLocale
-	case FaIR:
-		return faLocale
+// Args holds the values of the named placeholders of a text, like {username}.
+// The count argument also selects the plural form of the text.
+type Args map[string]interface{}
+
+// defaultLanguage is the language of the users who haven't chosen one and
+// whose Telegram client language isn't supported
+var defaultLanguage = Language(os.Getenv("DEFAULT_LANGUAGE"))
+
+// Localizer looks up texts and formats numbers and times in a single language
+// and time zone. It is created for every update so concurrent updates never
+// see each other's language.
+type Localizer struct {
+	language Language
+	location *time.Location
+}
+
+// NewLocalizer picks the first supported language of: the language set by the
+// user, the Telegram client language, DEFAULT_LANGUAGE and English. The
+// client language is empty when localizing for a user other than the sender.
+func NewLocalizer(userLanguage Language, clientLanguage string) Localizer {
+	for _, language := range []Language{userLanguage, clientLanguageOf(clientLanguage), defaultLanguage} {
+		if _, ok := catalog[language]; ok {
+			return Localizer{language: language, location: time.UTC}
+		}
 	}
-	return nil
+	return Localizer{language: EnUS, location: time.UTC}
 }
 
-// T retrieves a text based on the given language and text ID.
-func T(textID TextID) string {
-	if text, ok := locales[currentLocale][textID]; ok {
-		return text
+// In returns a copy of the localizer showing times in the given time zone
+func (l Localizer) In(location *time.Location) Localizer {
+	if location != nil {
+		l.location = location
 	}
-	return ""
+	return l
 }
 
-// TT retrieves a text based on the text ID and the given language
-func TT(textID TextID, userLanguage Language) string {
-	var language Language
-	if userLanguage != "" {
-		language = userLanguage
-	} else {
-		defaultLang := os.Getenv("DEFAULT_LANGUAGE")
-		if defaultLang != "" {
-			language = Language(defaultLang)
-		} else {
-			language = EnUS
+// Language returns the language the localizer looks texts up in
+func (l Localizer) Language() Language {
+	return l.language
+}
+
+// T retrieves the text with the given ID in the language of the localizer,
+// falling back to English for untranslated texts, and fills its placeholders
+// with the arguments.
+func (l Localizer) T(textID TextID, args ...Args) string {
+	language := l.language
+	text, ok := catalog[language][textID]
+	if !ok {
+		language = EnUS
+		text = catalog[language][textID]
+	}
+
+	values := make(Args)
+	for _, arg := range args {
+		for name, value := range arg {
+			values[name] = value
 		}
 	}
-	if _, ok := locales[language]; !ok {
-		locales[language] = loadLanguage(language)
+
+	form := text[Other]
+	if count, ok := values["count"]; ok && text.IsPlural() {
+		if n, ok := toInt64(count); ok {
+			if pluralForm, ok := text[pluralCategory(language, n)]; ok {
+				form = pluralForm
+			}
+		}
 	}
+	return format(language, form, values)
+}
 
-	if text, ok := locales[language][textID]; ok {
+// format replaces the named placeholders of the text with the argument values,
+// placeholders without a value are kept as they are. Integer values are
+// written with the digits of the language.
+func format(language Language, text string, args Args) string {
+	if len(args) == 0 {
 		return text
 	}
-	return ""
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := args[placeholder[1:len(placeholder)-1]]
+		if !ok {
+			return placeholder
+		}
+		if n, ok := toInt64(value); ok {
+			return localizeDigits(language, strconv.FormatInt(n, 10))
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
 }
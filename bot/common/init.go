@@ -5,26 +5,59 @@ import (
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/bugfloyd/anonymous-telegram-bot/secrets"
 	"log"
 	"net/http"
+	"time"
 )
 
 type APIResponse events.APIGatewayProxyResponse
 type APIRequest events.APIGatewayProxyRequest
 
-// InitBot is our lambda handler invoked by the `lambda.Start` function call
-func InitBot(request APIRequest) (APIResponse, error) {
-	// Create bot from environment value.
-	b, err := gotgbot.NewBot(secrets.BotToken, &gotgbot.BotOpts{
+// jobsWindow is how long a scheduled invocation keeps running the jobs coming
+// due, a bit less than the one minute between invocations
+const jobsWindow = 50 * time.Second
+
+// HandleLambdaEvent is our lambda handler invoked by the `lambda.Start`
+// function call. Webhook updates come through API Gateway, the scheduled
+// events of EventBridge run the due jobs.
+func HandleLambdaEvent(event json.RawMessage) (APIResponse, error) {
+	var source struct {
+		Source string `json:"source"`
+	}
+	if err := json.Unmarshal(event, &source); err == nil && source.Source == "aws.events" {
+		runner, err := newJobRunner()
+		if err != nil {
+			return APIResponse{StatusCode: 500}, err
+		}
+		err = runner.runJobsUntil(time.Now().Add(jobsWindow))
+		if err != nil {
+			return APIResponse{StatusCode: 500}, fmt.Errorf("failed to run jobs: %w", err)
+		}
+		return APIResponse{StatusCode: 200}, nil
+	}
+
+	var request APIRequest
+	if err := json.Unmarshal(event, &request); err != nil {
+		log.Println("failed to parse request:", err.Error())
+	}
+	return InitBot(request)
+}
+
+// newBot creates the bot from environment value
+func newBot() (*gotgbot.Bot, error) {
+	return gotgbot.NewBot(secrets.BotToken, &gotgbot.BotOpts{
 		BotClient: &gotgbot.BaseBotClient{
 			Client: http.Client{},
 		},
 	})
+}
+
+// InitBot serves a webhook update
+func InitBot(request APIRequest) (APIResponse, error) {
+	b, err := newBot()
 	if err != nil {
 		return APIResponse{StatusCode: 500}, fmt.Errorf("failed to create new bot: %w", err)
 	}
@@ -39,29 +72,7 @@ func InitBot(request APIRequest) (APIResponse, error) {
 		MaxRoutines: ext.DefaultMaxRoutines,
 	})
 
-	rootHandler := NewRootHandler()
-
-	// Commands
-	dispatcher.AddHandler(handlers.NewCommand(string(StartCommand), rootHandler.init(StartCommand)))
-	dispatcher.AddHandler(handlers.NewCommand(string(InfoCommand), rootHandler.init(InfoCommand)))
-	dispatcher.AddHandler(handlers.NewCommand(string(LinkCommand), rootHandler.init(LinkCommand)))
-	dispatcher.AddHandler(handlers.NewCommand(string(UsernameCommand), rootHandler.init(UsernameCommand)))
-	dispatcher.AddHandler(handlers.NewCommand(string(LanguageCommand), rootHandler.init(LanguageCommand)))
-	dispatcher.AddHandler(handlers.NewCommand(string(UnBlockAllCommand), rootHandler.init(UnBlockAllCommand)))
-
-	// Add handler to process all text messages
-	dispatcher.AddHandler(handlers.NewMessage(CustomSendMessageFilter, rootHandler.init(TextMessage)))
-
-	// Callback queries handlers
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("r|"), rootHandler.init(ReplyCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("b|"), rootHandler.init(BlockCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("ub|"), rootHandler.init(UnBlockCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("o|"), rootHandler.init(OpenCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("u"), rootHandler.init(SetUsernameCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("ru"), rootHandler.init(RemoveUsernameCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("cu"), rootHandler.init(CancelUsernameCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("l|"), rootHandler.init(SetLanguageCallback)))
-	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix("lc"), rootHandler.init(CancelLanguageCallback)))
+	registerRoutes(dispatcher)
 
 	var update gotgbot.Update
 	if err := json.Unmarshal([]byte(request.Body), &update); err != nil {
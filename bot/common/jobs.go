@@ -0,0 +1,194 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"github.com/guregu/dynamo"
+	"log"
+	"time"
+)
+
+const (
+	// jobPollInterval is how often a runner looks for jobs coming due
+	jobPollInterval = time.Second
+	// jobLease is how long a claimed job waits for its runner before it comes due again
+	jobLease = 30 * time.Second
+	// maxJobAttempts is how many times a failing job is tried before it is given up on
+	maxJobAttempts = 3
+)
+
+// jobHandler does the jobs of a kind in the context of their owner
+type jobHandler struct {
+	run func(r *RequestContext, b *gotgbot.Bot, job *users.Job) error
+	// failed tells the owner a job failing every attempt is given up on
+	failed func(r *RequestContext, b *gotgbot.Bot, job *users.Job) error
+}
+
+var jobHandlers = map[users.JobKind]jobHandler{
+	users.DeliverMessageJob:   {(*RequestContext).deliverMessageJob, (*RequestContext).deliverMessageFailed},
+	users.ScheduledMessageJob: {(*RequestContext).deliverMessageJob, (*RequestContext).deliverMessageFailed},
+}
+
+// retryLaterError is returned by a job which can't be done before a while,
+// like a delivery rate limited by Telegram
+type retryLaterError struct {
+	after time.Duration
+	err   error
+}
+
+func (e *retryLaterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryLaterError) Unwrap() error {
+	return e.err
+}
+
+// jobRunner does the due jobs with one bot and connection for as long as it runs
+type jobRunner struct {
+	bot     *gotgbot.Bot
+	db      *dynamo.DB
+	jobRepo *users.JobRepository
+}
+
+func newJobRunner() (*jobRunner, error) {
+	b, err := newBot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new bot: %w", err)
+	}
+	db := users.NewDB()
+	jobRepo, err := users.NewJobRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init job repo: %w", err)
+	}
+
+	return &jobRunner{
+		bot:     b,
+		db:      db,
+		jobRepo: jobRepo,
+	}, nil
+}
+
+// runDueJobs claims and does every job which is due. A failing job is logged
+// and tried again once its lease is over, until it runs out of attempts.
+func (runner *jobRunner) runDueJobs() error {
+	jobs, err := runner.jobRepo.ReadDueJobs(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		err = runner.jobRepo.ClaimJob(job, jobLease)
+		if errors.Is(err, users.ErrJobGone) {
+			// Another runner took it or its owner cancelled it
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = runner.runJob(job)
+		if err != nil {
+			log.Printf("failed to run %s job %s, attempt %d: %v", job.Kind, job.UUID, job.Attempts, err)
+			if job.Attempts < maxJobAttempts {
+				runner.retryJob(job, err)
+				continue
+			}
+			err = runner.giveUpJob(job)
+			if err != nil {
+				log.Printf("failed to give up %s job %s: %v", job.Kind, job.UUID, err)
+				continue
+			}
+		}
+
+		err = runner.jobRepo.CompleteJob(job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryJob leaves the failed job to be tried again once its lease is over, or
+// later if the job asked to wait longer than that
+func (runner *jobRunner) retryJob(job *users.Job, err error) {
+	var retry *retryLaterError
+	if !errors.As(err, &retry) || retry.after <= jobLease {
+		return
+	}
+	err = runner.jobRepo.PostponeJob(job, time.Now().Add(retry.after))
+	if err != nil && !errors.Is(err, users.ErrJobGone) {
+		log.Printf("failed to postpone %s job %s: %v", job.Kind, job.UUID, err)
+	}
+}
+
+// runJobsUntil keeps running the jobs coming due until the given time. It
+// lets a runner started once a minute do jobs due within seconds.
+func (runner *jobRunner) runJobsUntil(until time.Time) error {
+	for {
+		err := runner.runDueJobs()
+		if err != nil {
+			return err
+		}
+		if time.Now().Add(jobPollInterval).After(until) {
+			return nil
+		}
+		time.Sleep(jobPollInterval)
+	}
+}
+
+// StartJobTicker runs the due jobs every interval in the background, for
+// running the bot as a long-running server instead of on Lambda
+func StartJobTicker(interval time.Duration) error {
+	runner, err := newJobRunner()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			err := runner.runDueJobs()
+			if err != nil {
+				log.Println("failed to run due jobs:", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+func (runner *jobRunner) runJob(job *users.Job) error {
+	handler, ok := jobHandlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %s", job.Kind)
+	}
+
+	r, err := newUserRequestContext(runner.db, job.OwnerUUID)
+	if errors.Is(err, users.ErrNotFound) {
+		// The owner deleted their account since
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return handler.run(r, runner.bot, job)
+}
+
+func (runner *jobRunner) giveUpJob(job *users.Job) error {
+	handler, ok := jobHandlers[job.Kind]
+	if !ok {
+		return nil
+	}
+
+	r, err := newUserRequestContext(runner.db, job.OwnerUUID)
+	if errors.Is(err, users.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return handler.failed(r, runner.bot, job)
+}
@@ -4,46 +4,12 @@ import (
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
-	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
-	"strings"
 )
 
-func (r *RootHandler) manageLanguage(b *gotgbot.Bot, ctx *ext.Context) error {
-	var text string
-	if r.user.Language != "" {
-		text = fmt.Sprintf(i18n.T(i18n.YourLanguageText), r.user.Language)
-	} else {
-		text = i18n.T(i18n.NoPreferredLanguageSetText)
-	}
-	_, err := b.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{
-		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
-			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-				{
-					{
-						Text:         "English",
-						CallbackData: fmt.Sprintf("l|%s", i18n.EnUS),
-					},
-					{
-						Text:         "فارسی",
-						CallbackData: fmt.Sprintf("l|%s", i18n.FaIR),
-					},
-					{
-						Text:         i18n.T(i18n.CancelButtonText),
-						CallbackData: "lc",
-					},
-				},
-			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to send language info: %w", err)
-	}
-
-	return nil
-}
-
-func (r *RootHandler) languageCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
+// languageCallback serves the language buttons sent before the settings menu
+func (r *RequestContext) languageCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
 	cb := ctx.Update.CallbackQuery
 
 	// Remove language command buttons
@@ -55,51 +21,41 @@ func (r *RootHandler) languageCallback(b *gotgbot.Bot, ctx *ext.Context, action
 	if action == "CANCEL" {
 		// Send callback answer to telegram
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-			Text: i18n.T(i18n.NeverMindButtonText),
+			Text: r.locale.T(i18n.NeverMindButtonText),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to answer callback: %w", err)
 		}
 	} else if action == "SET" {
-		split := strings.Split(cb.Data, "|")
-		if len(split) != 2 {
-			return fmt.Errorf("invalid callback data: %s", cb.Data)
-		}
-
-		var isLanguageValid = false
-		var language i18n.Language
-		for _, lang := range []i18n.Language{i18n.EnUS, i18n.FaIR} {
-			if split[1] == string(lang) {
-				isLanguageValid = true
-				language = lang
-				break
-			}
+		var data languageData
+		err = callbacks.Decode(cb.Data, &data)
+		if err != nil {
+			return err
 		}
 
-		if isLanguageValid == false {
-			return fmt.Errorf("invalid language code in callback data: %s", cb.Data)
+		info, ok := i18n.LookupLanguage(data.Language)
+		if !ok {
+			return fmt.Errorf("%w: unknown language %s", callbacks.ErrInvalid, data.Language)
 		}
 
 		err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
-			"State":          users.Idle,
-			"ContactUUID":    "",
-			"ReplyMessageID": 0,
-			"Language":       language,
+			"Language": info.Code,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to update user language: %w", err)
 		}
-		i18n.SetLocale(r.user.Language, ctx.EffectiveUser.LanguageCode)
+		// Confirm in the newly chosen language
+		locale := i18n.NewLocalizer(r.user.Language, ctx.EffectiveUser.LanguageCode).In(r.user.Location())
 
 		// Send update status
-		_, err = ctx.EffectiveMessage.Reply(b, i18n.T(i18n.LanguageUpdatedSuccessfullyText), nil)
+		_, err = ctx.EffectiveMessage.Reply(b, locale.T(i18n.LanguageUpdatedSuccessfullyText), nil)
 		if err != nil {
 			return fmt.Errorf("failed to send language update message: %w", err)
 		}
 
 		// Send callback answer to telegram
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-			Text:      i18n.T(i18n.LanguageUpdatedSuccessfullyText),
+			Text:      locale.T(i18n.LanguageUpdatedSuccessfullyText),
 			ShowAlert: false,
 		})
 		if err != nil {
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"strings"
+)
+
+// menuPage is a page of an inline keyboard menu. A menu lives in a single
+// message which is edited in place as the user moves between its pages.
+type menuPage struct {
+	// parent is the page the back button leads to, the root page has none and gets a close button instead
+	parent string
+	// render returns the text and the buttons of the page without the back or close row
+	render func(r *RequestContext, b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error)
+	// act runs the action of a button of the page and returns the text the
+	// button press is answered with. The page is rendered again afterwards.
+	act func(r *RequestContext, b *gotgbot.Bot, action string) (string, error)
+}
+
+// menu is a set of pages addressed by their IDs
+type menu map[string]menuPage
+
+// menuButton returns a button opening the page of the menu, running the action of the page first if set
+func menuButton(text string, page string, action string) (gotgbot.InlineKeyboardButton, error) {
+	callbackData, err := callbacks.Encode(menuData{Page: page, Action: action})
+	if err != nil {
+		return gotgbot.InlineKeyboardButton{}, err
+	}
+	return gotgbot.InlineKeyboardButton{
+		Text:         text,
+		CallbackData: callbackData,
+	}, nil
+}
+
+// renderMenu renders a page of the menu with its navigation row
+func (r *RequestContext) renderMenu(b *gotgbot.Bot, m menu, id string) (string, gotgbot.InlineKeyboardMarkup, error) {
+	page, ok := m[id]
+	if !ok {
+		return "", gotgbot.InlineKeyboardMarkup{}, fmt.Errorf("%w: unknown menu page %s", callbacks.ErrInvalid, id)
+	}
+	text, buttons, err := page.render(r, b)
+	if err != nil {
+		return "", gotgbot.InlineKeyboardMarkup{}, err
+	}
+
+	if page.parent != "" {
+		backButton, err := menuButton(r.locale.T(i18n.BackButtonText), page.parent, "")
+		if err != nil {
+			return "", gotgbot.InlineKeyboardMarkup{}, err
+		}
+		buttons = append(buttons, []gotgbot.InlineKeyboardButton{backButton})
+	} else {
+		buttons = append(buttons, []gotgbot.InlineKeyboardButton{
+			{
+				Text:         r.locale.T(i18n.CloseButtonText),
+				CallbackData: closeMenuButton,
+			},
+		})
+	}
+
+	return text, gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons}, nil
+}
+
+// sendMenu sends a new message showing a page of the menu
+func (r *RequestContext) sendMenu(b *gotgbot.Bot, ctx *ext.Context, m menu, id string) error {
+	text, keyboard, err := r.renderMenu(b, m, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send menu: %w", err)
+	}
+	return nil
+}
+
+// menuCallback returns the handler of the menu buttons, which runs the action
+// of the button and shows the page it leads to in place
+func menuCallback(m menu) routeHandler {
+	return func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context) error {
+		return r.showMenuPage(b, ctx.Update.CallbackQuery, m)
+	}
+}
+
+func (r *RequestContext) showMenuPage(b *gotgbot.Bot, cb *gotgbot.CallbackQuery, m menu) error {
+	var data menuData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+	page, ok := m[data.Page]
+	if !ok {
+		return fmt.Errorf("%w: unknown menu page %s", callbacks.ErrInvalid, data.Page)
+	}
+
+	var answer string
+	if data.Action != "" && page.act != nil {
+		answer, err = page.act(r, b, data.Action)
+		if err != nil {
+			return err
+		}
+	}
+
+	text, keyboard, err := r.renderMenu(b, m, data.Page)
+	if err != nil {
+		return err
+	}
+	_, _, err = cb.Message.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: keyboard,
+	})
+	// Pressing a button of the page already shown doesn't change the message
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return fmt.Errorf("failed to update menu message: %w", err)
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answer,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	return nil
+}
+
+func (r *RequestContext) closeMenuCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+
+	_, err := cb.Message.Delete(b, &gotgbot.DeleteMessageOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to delete menu message: %w", err)
+	}
+
+	_, err = cb.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	return nil
+}
@@ -1,66 +1,455 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/delivery"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
-	"strconv"
-	"strings"
+	"log"
+	"time"
 )
 
-func (r *RootHandler) sendAnonymousMessage(b *gotgbot.Bot, ctx *ext.Context) error {
-	receiver, err := r.userRepo.ReadUserByUUID(r.user.ContactUUID)
+// sendingPayload is kept while the user writes an anonymous message
+type sendingPayload struct {
+	ContactUUID string
+	// ReplyMessageID is the message of the receiver being replied to, zero for a new conversation
+	ReplyMessageID int64 `json:",omitempty"`
+	// Recipient is the username or link the receiver was reached with, shown when a conversation starts
+	Recipient string `json:",omitempty"`
+	// DraftMessageID is the message of the sender waiting for them to confirm sending it
+	DraftMessageID int64 `json:",omitempty"`
+	// Scheduling is set once the sender chose to schedule the message they write
+	Scheduling bool `json:",omitempty"`
+}
+
+// sendingTTL is how long the bot waits for the message, or its confirmation, once a receiver is chosen
+const sendingTTL = time.Hour
+
+var sendingStep = flowStep[sendingPayload]{
+	state:   users.Sending,
+	ttl:     sendingTTL,
+	expired: i18n.SendingExpiredText,
+	prompt: func(r *RequestContext, payload sendingPayload) string {
+		if payload.ReplyMessageID != 0 {
+			return r.locale.T(i18n.ReplyToThisMessageText)
+		}
+		return r.locale.T(i18n.InitialSendMessagePromptText, i18n.Args{"recipient": r.locale.Isolate(payload.Recipient)})
+	},
+	keyboard: func(r *RequestContext, payload sendingPayload) ([][]gotgbot.InlineKeyboardButton, error) {
+		return [][]gotgbot.InlineKeyboardButton{
+			{
+				{
+					Text:         r.locale.T(i18n.ScheduleButtonText),
+					CallbackData: startScheduleButton,
+				},
+			},
+		}, nil
+	},
+	handle: (*RequestContext).sendAnonymousMessage,
+}
+
+func (r *RequestContext) sendAnonymousMessage(b *gotgbot.Bot, ctx *ext.Context, payload sendingPayload) error {
+	if payload.Scheduling {
+		return r.pickScheduleTime(b, ctx, payload)
+	}
+	if r.user.ConfirmSending {
+		return r.previewMessage(b, ctx, payload)
+	}
+	return r.sendMessage(b, ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageId, payload)
+}
+
+// sendMessage ends the sending flow with delivering the message, after the
+// undo window of the sender if they have one
+func (r *RequestContext) sendMessage(b *gotgbot.Bot, chatID int64, messageID int64, payload sendingPayload) error {
+	var err error
+	if r.user.SendDelay > 0 {
+		err = r.queueMessage(b, chatID, messageID, payload)
+	} else {
+		err = r.deliverMessage(b, chatID, messageID, payload)
+	}
+	var retry *retryLaterError
+	if errors.As(err, &retry) {
+		err = r.postponeMessage(b, chatID, messageID, payload, retry.after)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Reset sender user
+	return r.userRepo.ResetUserState(r.user)
+}
+
+// deliveryPayload is the payload of the job delivering a message after its undo window
+type deliveryPayload struct {
+	Sending   sendingPayload
+	MessageID int64
+	// UndoMessageID is the message with the undo button, or the one telling
+	// the sender the delivery is postponed, removed once the message is
+	// delivered. Scheduled messages have none.
+	UndoMessageID int64 `json:",omitempty"`
+}
+
+// queueMessage delivers the message once the undo window of the sender is
+// over, until then they can take it back with the undo button
+func (r *RequestContext) queueMessage(b *gotgbot.Bot, chatID int64, messageID int64, payload sendingPayload) error {
+	delay := time.Duration(r.user.SendDelay) * time.Second
+	job := users.NewJob(r.user, users.DeliverMessageJob, time.Now().Add(delay))
+
+	undoButtonData, err := callbacks.Encode(undoSendData{JobUUID: job.UUID})
+	if err != nil {
+		return err
+	}
+	undoMessage, err := b.SendMessage(chatID, r.locale.T(i18n.SendingInText, i18n.Args{"count": r.user.SendDelay}), &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+				{
+					{
+						Text:         r.locale.T(i18n.UndoSendButtonText),
+						CallbackData: undoButtonData,
+					},
+				},
+			},
+		},
+		ReplyParameters: &gotgbot.ReplyParameters{
+			MessageId:                messageID,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send undo message: %w", err)
+	}
+
+	err = job.SetPayload(deliveryPayload{
+		Sending:       payload,
+		MessageID:     messageID,
+		UndoMessageID: undoMessage.MessageId,
+	})
+	if err != nil {
+		return err
+	}
+	return r.jobRepo.CreateJob(job)
+}
+
+// deliverMessageJob delivers a message whose undo window is over or whose scheduled time has come
+func (r *RequestContext) deliverMessageJob(b *gotgbot.Bot, job *users.Job) error {
+	var payload deliveryPayload
+	err := job.DecodePayload(&payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode delivery payload: %w", err)
+	}
+
+	err = r.deliverMessage(b, r.user.UserID, payload.MessageID, payload.Sending)
+	var retry *retryLaterError
+	if errors.As(err, &retry) && payload.UndoMessageID != 0 {
+		// The message can't be taken back anymore while its delivery is retried
+		_, _, editErr := b.EditMessageText(r.locale.T(i18n.MessagePostponedText), &gotgbot.EditMessageTextOpts{
+			ChatId:    r.user.UserID,
+			MessageId: payload.UndoMessageID,
+		})
+		if editErr != nil {
+			log.Printf("failed to update undo message: %v", editErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if payload.UndoMessageID != 0 {
+		_, err = b.DeleteMessage(r.user.UserID, payload.UndoMessageID, nil)
+		if err != nil {
+			log.Printf("failed to delete message: %v", err)
+		}
+	}
+	return nil
+}
+
+// postponeMessage delivers a message Telegram didn't let through yet with a
+// job once the given time has passed, and tells the sender so
+func (r *RequestContext) postponeMessage(b *gotgbot.Bot, chatID int64, messageID int64, payload sendingPayload, after time.Duration) error {
+	notice, err := b.SendMessage(chatID, r.locale.T(i18n.MessagePostponedText), &gotgbot.SendMessageOpts{
+		ReplyParameters: &gotgbot.ReplyParameters{
+			MessageId:                messageID,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send postponed message notice: %w", err)
+	}
+
+	job := users.NewJob(r.user, users.DeliverMessageJob, time.Now().Add(after))
+	err = job.SetPayload(deliveryPayload{
+		Sending: sendingPayload{
+			ContactUUID:    payload.ContactUUID,
+			ReplyMessageID: payload.ReplyMessageID,
+		},
+		MessageID:     messageID,
+		UndoMessageID: notice.MessageId,
+	})
+	if err != nil {
+		return err
+	}
+	return r.jobRepo.CreateJob(job)
+}
+
+// deliverMessageFailed tells the sender the message couldn't be delivered after every attempt
+func (r *RequestContext) deliverMessageFailed(b *gotgbot.Bot, job *users.Job) error {
+	var payload deliveryPayload
+	err := job.DecodePayload(&payload)
+	if err != nil {
+		return fmt.Errorf("failed to decode delivery payload: %w", err)
+	}
+
+	text := r.locale.T(i18n.MessageNotDeliveredText)
+	if payload.UndoMessageID != 0 {
+		_, _, err = b.EditMessageText(text, &gotgbot.EditMessageTextOpts{
+			ChatId:    r.user.UserID,
+			MessageId: payload.UndoMessageID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update undo message: %w", err)
+		}
+		return nil
+	}
+
+	_, err = b.SendMessage(r.user.UserID, text, &gotgbot.SendMessageOpts{
+		ReplyParameters: &gotgbot.ReplyParameters{
+			MessageId:                payload.MessageID,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send delivery failure message: %w", err)
+	}
+	return nil
+}
+
+func (r *RequestContext) undoSendCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data undoSendData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	err = r.jobRepo.CancelJob(r.user, data.JobUUID)
+	if errors.Is(err, users.ErrJobGone) {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text:      r.locale.T(i18n.TooLateToUndoText),
+			ShowAlert: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	_, _, err = cb.Message.EditText(b, r.locale.T(i18n.MessageUnsentText), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update undo message: %w", err)
+	}
+	return nil
+}
+
+// previewMessage keeps the message as the draft of the sender and asks them to
+// confirm sending it. A newer message replaces the draft.
+func (r *RequestContext) previewMessage(b *gotgbot.Bot, ctx *ext.Context, payload sendingPayload) error {
+	payload.DraftMessageID = ctx.EffectiveMessage.MessageId
+	err := r.userRepo.SetState(r.user, users.Sending, payload, time.Now().Add(sendingTTL))
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	sendButtonData, err := callbacks.Encode(sendDraftData{MessageID: payload.DraftMessageID})
+	if err != nil {
+		return err
+	}
+	discardButtonData, err := callbacks.Encode(discardDraftData{MessageID: payload.DraftMessageID})
+	if err != nil {
+		return err
+	}
+	now := time.Now().In(r.user.Location())
+	scheduleButton, err := callbackButton(r.locale.T(i18n.ScheduleButtonText), schedulePickerData{
+		MessageID: payload.DraftMessageID,
+		Step:      scheduleMonthStep,
+		Year:      now.Year(),
+		Month:     int(now.Month()),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.SendPreviewText), &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+				{
+					{
+						Text:         r.locale.T(i18n.SendDraftButtonText),
+						CallbackData: sendButtonData,
+					},
+					{
+						Text:         r.locale.T(i18n.DiscardDraftButtonText),
+						CallbackData: discardButtonData,
+					},
+				},
+				{scheduleButton},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send preview message: %w", err)
+	}
+	return nil
+}
+
+// pendingDraft returns the sending payload of the user if the draft is still
+// waiting for confirmation, buttons of older previews are expired
+func (r *RequestContext) pendingDraft(messageID int64) (sendingPayload, error) {
+	var payload sendingPayload
+	if r.user.State != users.Sending || r.user.StateExpired() {
+		return payload, fmt.Errorf("%w: no message is waiting to be sent", callbacks.ErrInvalid)
+	}
+	err := r.user.StatePayload(&payload)
+	if err != nil {
+		return payload, fmt.Errorf("failed to read sending state payload: %w", err)
+	}
+	if payload.DraftMessageID == 0 || payload.DraftMessageID != messageID {
+		return payload, fmt.Errorf("%w: draft %d is not waiting to be sent", callbacks.ErrInvalid, messageID)
+	}
+	return payload, nil
+}
+
+func (r *RequestContext) sendDraftCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data sendDraftData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+	payload, err := r.pendingDraft(data.MessageID)
+	if err != nil {
+		return err
+	}
+
+	err = r.sendMessage(b, ctx.EffectiveChat.Id, payload.DraftMessageID, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: r.locale.T(i18n.MessageSentText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	// Delete the preview, the draft shows it was sent by its reaction
+	_, err = cb.Message.Delete(b, &gotgbot.DeleteMessageOpts{})
+	if err != nil {
+		log.Printf("failed to delete message: %v", err)
+	}
+	return nil
+}
+
+func (r *RequestContext) discardDraftCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data discardDraftData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+	_, err = r.pendingDraft(data.MessageID)
+	if err != nil {
+		return err
+	}
+
+	err = r.userRepo.ResetUserState(r.user)
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: r.locale.T(i18n.DraftDiscardedText),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+
+	_, err = cb.Message.Delete(b, &gotgbot.DeleteMessageOpts{})
+	if err != nil {
+		log.Printf("failed to delete message: %v", err)
+	}
+	return nil
+}
+
+// deliverMessage sends the message of the sender anonymously to the receiver of the payload
+func (r *RequestContext) deliverMessage(b *gotgbot.Bot, chatID int64, messageID int64, payload sendingPayload) error {
+	receiver, err := r.userRepo.ReadUserByUUID(payload.ContactUUID)
 	if err != nil {
 		return fmt.Errorf("failed to get receiver: %w", err)
 	}
 
 	// Check if they block each other
-	blockedBy := blockCheck(r.user, receiver)
+	blockedBy, err := r.blockCheck(r.user, receiver)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
 	if blockedBy != None {
 		var reason string
 		if blockedBy == Sender {
-			reason = i18n.T(i18n.YouHaveBlockedThisUserText)
+			reason = r.locale.T(i18n.YouHaveBlockedThisUserText)
 		} else if blockedBy == Receiver {
-			reason = i18n.T(i18n.ThisUserHasBlockedYouText)
+			reason = r.locale.T(i18n.ThisUserHasBlockedYouText)
 		}
-		_, err = ctx.EffectiveMessage.Reply(b, reason, nil)
+		_, err = b.SendMessage(chatID, reason, &gotgbot.SendMessageOpts{
+			ReplyParameters: &gotgbot.ReplyParameters{
+				MessageId:                messageID,
+				AllowSendingWithoutReply: true,
+			},
+		})
 		if err != nil {
 			return fmt.Errorf("failed to send block message: %w", err)
 		}
-
-		// Reset sender user
-		err = r.userRepo.ResetUserState(r.user)
-		if err != nil {
-			return err
-		}
-
 		return nil
 	}
 
+	// Muted senders are delivered without a notification, as is everything for receivers preferring silent messages
+	muted, err := r.isMutedBy(receiver, r.user)
+	if err != nil {
+		return fmt.Errorf("failed to check mute: %w", err)
+	}
+
+	// The notification is read by the receiver, in their own language
+	receiverLocale := i18n.NewLocalizer(receiver.Language, "").In(receiver.Location())
+
 	var replyParameters *gotgbot.ReplyParameters
-	msgText := i18n.TT(i18n.YouHaveANewMessageText, receiver.Language)
-	if r.user.ReplyMessageID != 0 {
+	msgText := receiverLocale.T(i18n.YouHaveANewMessageText)
+	if payload.ReplyMessageID != 0 {
 		replyParameters = &gotgbot.ReplyParameters{
-			MessageId:                r.user.ReplyMessageID,
+			MessageId:                payload.ReplyMessageID,
 			AllowSendingWithoutReply: true,
 		}
 
-		msgText = i18n.TT(i18n.NewReplyToYourMessageText, receiver.Language)
+		msgText = receiverLocale.T(i18n.NewReplyToYourMessageText)
 	}
 
-	// React with sent emoji to senderMessageID
-	_, err = ctx.EffectiveMessage.SetReaction(b, &gotgbot.SetMessageReactionOpts{
-		Reaction: []gotgbot.ReactionType{
-			gotgbot.ReactionTypeEmoji{
-				Emoji: "🕊",
-			},
-		},
-		IsBig: false,
-	})
+	message, err := r.messageRepo.CreateMessage(r.user, receiver, messageID, payload.ReplyMessageID)
 	if err != nil {
-		return fmt.Errorf("failed to react to sender's message: %w", err)
+		return fmt.Errorf("failed to store message: %w", err)
+	}
+	openButtonData, err := callbacks.Encode(openData{MessageUUID: message.UUID})
+	if err != nil {
+		return err
 	}
 
 	// Send the new message notification to the receiver
@@ -69,51 +458,135 @@ func (r *RootHandler) sendAnonymousMessage(b *gotgbot.Bot, ctx *ext.Context) err
 			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 				{
 					{
-						Text:         i18n.TT(i18n.OpenMessageButtonText, receiver.Language),
-						CallbackData: fmt.Sprintf("o|%s|%d", r.user.UUID, ctx.EffectiveMessage.MessageId),
+						Text:         receiverLocale.T(i18n.OpenMessageButtonText),
+						CallbackData: openButtonData,
 					},
 				},
 			},
 		},
-		ReplyParameters: replyParameters,
+		ReplyParameters:     replyParameters,
+		DisableNotification: muted || receiver.SilentMessages,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to send message to receiver: %w", err)
+		return r.deliveryFailed(b, chatID, messageID, receiver, message, err)
 	}
 
-	// Reset sender user
-	err = r.userRepo.ResetUserState(r.user)
+	// The message is delivered, failing after this must not get a job
+	// delivering it again. Receivers marked inactive who can be reached
+	// again are back.
+	if receiver.Inactive {
+		err = r.userRepo.UpdateUser(receiver, map[string]interface{}{
+			"Inactive": false,
+		})
+		if err != nil {
+			log.Printf("failed to reactivate receiver: %v", err)
+		}
+	}
+
+	// React with sent emoji to senderMessageID
+	_, err = b.SetMessageReaction(chatID, messageID, &gotgbot.SetMessageReactionOpts{
+		Reaction: []gotgbot.ReactionType{
+			gotgbot.ReactionTypeEmoji{
+				Emoji: "🕊",
+			},
+		},
+		IsBig: false,
+	})
+	if err != nil {
+		log.Printf("failed to react to sender's message: %v", err)
+	}
+	return nil
+}
+
+// deliveryFailed handles a notification which couldn't be sent to the
+// receiver. A receiver who can't be reached anymore is marked inactive and the
+// sender is told so, a rate limited delivery asks to be retried later.
+func (r *RequestContext) deliveryFailed(b *gotgbot.Bot, chatID int64, messageID int64, receiver *users.User, message *users.Message, sendErr error) error {
+	// The notification of the message never arrived
+	err := r.messageRepo.DeleteMessage(message)
 	if err != nil {
 		return err
 	}
 
+	failure, retryAfter := delivery.Classify(sendErr)
+	if failure == delivery.RateLimited {
+		return &retryLaterError{
+			after: retryAfter,
+			err:   fmt.Errorf("failed to send message to receiver: %w", sendErr),
+		}
+	}
+	if !failure.Permanent() {
+		return fmt.Errorf("failed to send message to receiver: %w", sendErr)
+	}
+
+	err = r.userRepo.UpdateUser(receiver, map[string]interface{}{
+		"Inactive": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark receiver inactive: %w", err)
+	}
+
+	_, err = b.SendMessage(chatID, r.locale.T(i18n.ReceiverUnreachableText), &gotgbot.SendMessageOpts{
+		ReplyParameters: &gotgbot.ReplyParameters{
+			MessageId:                messageID,
+			AllowSendingWithoutReply: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send delivery failure message: %w", err)
+	}
 	return nil
 }
 
-func (r *RootHandler) openCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+func (r *RequestContext) openCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
-	split := strings.Split(cb.Data, "|")
-	if len(split) != 3 {
-		return fmt.Errorf("invalid callback data: %s", cb.Data)
+
+	var message *users.Message
+	var senderUUID string
+	var senderMessageID int64
+	var data openData
+	err := callbacks.Decode(cb.Data, &data)
+	if err == nil {
+		message, err = r.messageRepo.ReadMessage(data.MessageUUID)
+		if err != nil {
+			return fmt.Errorf("failed to get message: %w", err)
+		}
+		if message == nil {
+			return r.messageNoLongerAvailable(b, cb)
+		}
+		senderUUID = message.SenderUUID
+		senderMessageID = message.SenderMessageID
+	} else {
+		// Buttons sent before message records existed carry the sender and message ID
+		var legacyData legacyOpenData
+		err = callbacks.Decode(cb.Data, &legacyData)
+		if err != nil {
+			return err
+		}
+		senderUUID = legacyData.SenderUUID
+		senderMessageID = legacyData.SenderMessageID
+	}
+
+	sender, err := r.userRepo.ReadUserByUUID(senderUUID)
+	if errors.Is(err, users.ErrNotFound) {
+		return r.messageNoLongerAvailable(b, cb)
 	}
-	uuid := split[1]
-	sender, err := r.userRepo.ReadUserByUUID(uuid)
 	if err != nil {
-		return fmt.Errorf("failed to get receiver: %w", err)
+		return fmt.Errorf("failed to get sender: %w", err)
+	}
+
+	keyboard, err := r.messageKeyboard(sender.UUID, senderMessageID)
+	if err != nil {
+		return err
 	}
 
 	// Send callback answer to telegram
 	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-		Text: i18n.T(i18n.MessageOpenedText),
+		Text: r.locale.T(i18n.MessageOpenedText),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to answer callback: %w", err)
 	}
-
-	senderMessageID, err := strconv.ParseInt(split[2], 10, 64)
-	if err != nil {
-		return fmt.Errorf("failed to parse message ID: %w", err)
-	}
 	var replyMessageID int64
 	if ctx.EffectiveMessage.ReplyToMessage != nil {
 		replyMessageID = ctx.EffectiveMessage.ReplyToMessage.MessageId
@@ -121,20 +594,7 @@ func (r *RootHandler) openCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 
 	// Copy the sender's message to the receiver
 	_, err = b.CopyMessage(ctx.EffectiveChat.Id, sender.UserID, senderMessageID, &gotgbot.CopyMessageOpts{
-		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
-			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
-				{
-					{
-						Text:         i18n.T(i18n.ReplyButtonText),
-						CallbackData: fmt.Sprintf("r|%s|%d", sender.UUID, senderMessageID),
-					},
-					{
-						Text:         i18n.T(i18n.BlockButtonText),
-						CallbackData: fmt.Sprintf("b|%s|%d", sender.UUID, senderMessageID),
-					},
-				},
-			},
-		},
+		ReplyMarkup: keyboard,
 		ReplyParameters: &gotgbot.ReplyParameters{
 			MessageId:                replyMessageID,
 			AllowSendingWithoutReply: true,
@@ -144,39 +604,64 @@ func (r *RootHandler) openCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 		return fmt.Errorf("failed to send message to receiver: %w", err)
 	}
 
-	// React with eyes emoji to senderMessageID
-	_, err = b.SetMessageReaction(sender.UserID, senderMessageID, &gotgbot.SetMessageReactionOpts{
-		Reaction: []gotgbot.ReactionType{
-			gotgbot.ReactionTypeEmoji{
-				Emoji: "👀",
+	if message != nil {
+		err = r.messageRepo.MarkMessageOpened(message)
+		if err != nil {
+			log.Printf("failed to mark message as opened: %v", err)
+		}
+	}
+
+	// React with eyes emoji to senderMessageID, unless the receiver hides read receipts
+	if !r.user.HideReadReceipts {
+		_, err = b.SetMessageReaction(sender.UserID, senderMessageID, &gotgbot.SetMessageReactionOpts{
+			Reaction: []gotgbot.ReactionType{
+				gotgbot.ReactionTypeEmoji{
+					Emoji: "👀",
+				},
 			},
-		},
-		IsBig: false,
+			IsBig: false,
+		})
+		if err != nil {
+			log.Printf("failed to react to sender's message: %v", err)
+		}
+	}
+
+	// Delete message with "Open" button
+	_, err = cb.Message.Delete(b, &gotgbot.DeleteMessageOpts{})
+	if err != nil {
+		log.Printf("failed to delete message: %v", err)
+	}
+
+	return nil
+}
+
+// messageNoLongerAvailable tells the receiver that the message behind an "Open" button was deleted
+func (r *RequestContext) messageNoLongerAvailable(b *gotgbot.Bot, cb *gotgbot.CallbackQuery) error {
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text:      r.locale.T(i18n.MessageNoLongerAvailableText),
+		ShowAlert: true,
 	})
 	if err != nil {
-		fmt.Println("failed to react to sender's message: %w", err)
+		return fmt.Errorf("failed to answer callback: %w", err)
 	}
 
-	// Delete message with "Open" button
 	_, err = cb.Message.Delete(b, &gotgbot.DeleteMessageOpts{})
 	if err != nil {
-		fmt.Println("failed to delete message: %w", err)
+		log.Printf("failed to delete message: %v", err)
 	}
 
 	return nil
 }
 
-func (r *RootHandler) replyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+func (r *RequestContext) replyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	cb := ctx.Update.CallbackQuery
-	split := strings.Split(cb.Data, "|")
-	if len(split) != 3 {
-		return fmt.Errorf("invalid callback data: %s", cb.Data)
-	}
-	receiverUUID := split[1]
-	messageID, err := strconv.ParseInt(split[2], 10, 64)
+	var data replyData
+	err := callbacks.Decode(cb.Data, &data)
 	if err != nil {
-		return fmt.Errorf("failed to parse message ID: %w", err)
+		return err
 	}
+	receiverUUID := data.ContactUUID
+	messageID := data.MessageID
 
 	// Check if receiver exists
 	receiver, err := r.userRepo.ReadUserByUUID(receiverUUID)
@@ -185,18 +670,25 @@ func (r *RootHandler) replyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 	}
 
 	// Check if they block each other
-	blockedBy := blockCheck(r.user, receiver)
+	blockedBy, err := r.blockCheck(r.user, receiver)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
 	if blockedBy != None {
 		var reason string
 		if blockedBy == Sender {
-			reason = i18n.T(i18n.YouHaveBlockedThisUserText)
+			reason = r.locale.T(i18n.YouHaveBlockedThisUserText)
+			unBlockButtonData, err := callbacks.Encode(unBlockData(data))
+			if err != nil {
+				return err
+			}
 			_, _, err = cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{
 				ReplyMarkup: gotgbot.InlineKeyboardMarkup{
 					InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 						{
 							{
-								Text:         i18n.T(i18n.UnblockButtonText),
-								CallbackData: fmt.Sprintf("ub|%s|%d", receiverUUID, messageID),
+								Text:         r.locale.T(i18n.UnblockButtonText),
+								CallbackData: unBlockButtonData,
 							},
 						},
 					},
@@ -208,7 +700,7 @@ func (r *RootHandler) replyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 			}
 
 		} else if blockedBy == Receiver {
-			reason = i18n.T(i18n.ThisUserHasBlockedYouText)
+			reason = r.locale.T(i18n.ThisUserHasBlockedYouText)
 		}
 
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
@@ -222,29 +714,33 @@ func (r *RootHandler) replyCallback(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	// Store the message id in the user and set status to replying
-	err = r.userRepo.UpdateUser(r.user, map[string]interface{}{
-		"State":          users.Sending,
-		"ContactUUID":    receiverUUID,
-		"ReplyMessageID": messageID,
+	if receiver.Inactive {
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text:      r.locale.T(i18n.ReceiverInactiveText),
+			ShowAlert: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+		return nil
+	}
+
+	// Keep the message id in the state while the user writes the reply
+	err = sendingStep.start(r, b, ctx.EffectiveChat.Id, sendingPayload{
+		ContactUUID:    receiverUUID,
+		ReplyMessageID: messageID,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update user state: %w", err)
+		return err
 	}
 
 	// Send callback answer to telegram
 	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-		Text: i18n.T(i18n.ReplyingToMessageText),
+		Text: r.locale.T(i18n.ReplyingToMessageText),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to answer callback: %w", err)
 	}
 
-	// Send reply instruction
-	_, err = ctx.EffectiveMessage.Reply(b, i18n.T(i18n.ReplyToThisMessageText), nil)
-	if err != nil {
-		return fmt.Errorf("failed to send reply message: %w", err)
-	}
-
 	return nil
 }
@@ -4,26 +4,15 @@ import (
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/usernames"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
 	"github.com/bugfloyd/anonymous-telegram-bot/secrets"
 	"github.com/sqids/sqids-go"
-	"strings"
 )
 
-func (r *RootHandler) processUser(userRepo *users.UserRepository, ctx *ext.Context) (*users.User, error) {
-	user, err := userRepo.ReadUserByUserId(ctx.EffectiveUser.Id)
-	if err != nil {
-		user, err = userRepo.CreateUser(ctx.EffectiveUser.Id)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	return user, nil
-}
-
-func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
+func (r *RequestContext) start(b *gotgbot.Bot, ctx *ext.Context) error {
 	args := ctx.Args()
 	if len(args) == 1 && args[0] == "/start" {
 		// Reset user state
@@ -32,7 +21,7 @@ func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
 			return err
 		}
 
-		_, err = b.SendMessage(ctx.EffectiveChat.Id, i18n.T(i18n.StartMessageText), &gotgbot.SendMessageOpts{})
+		_, err = b.SendMessage(ctx.EffectiveChat.Id, r.locale.T(i18n.StartMessageText), &gotgbot.SendMessageOpts{})
 		if err != nil {
 			return fmt.Errorf("failed to send bot info: %w", err)
 		}
@@ -43,12 +32,11 @@ func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
 		var receiverUser *users.User
 		var identity string
 
-		if strings.HasPrefix(args[1], "_") {
-			username := args[1][1:]
+		if username, ok := usernames.ParseLinkPayload(args[1]); ok {
 			receiverUser, err = r.userRepo.ReadUserByUsername(username)
 			if receiverUser == nil || err != nil {
 				fmt.Println("failed to retrieve the link owner:", err)
-				_, err = b.SendMessage(ctx.EffectiveChat.Id, i18n.T(i18n.UserNotFoundText), &gotgbot.SendMessageOpts{})
+				_, err = b.SendMessage(ctx.EffectiveChat.Id, r.locale.T(i18n.UserNotFoundText), &gotgbot.SendMessageOpts{})
 				if err != nil {
 					return fmt.Errorf("failed to send wrong link response: %w", err)
 				}
@@ -56,24 +44,31 @@ func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
 			}
 			identity = receiverUser.Username
 		} else {
-			linkKey, createdAt, err := readUserLinkKey(args[1])
+			// Vanity slugs are resolved before the generic link keys
+			receiverUser, err = r.userRepo.ReadUserBySlug(args[1], slugRedirectWindow)
 			if err != nil {
-				return fmt.Errorf("failed to read the link key: %w", err)
+				return fmt.Errorf("failed to read the link slug: %w", err)
 			}
-			receiverUser, err = r.userRepo.ReadUserByLinkKey(linkKey, createdAt)
-			if receiverUser == nil || err != nil {
-				fmt.Println("failed to retrieve the link owner:", err)
-				_, err = b.SendMessage(ctx.EffectiveChat.Id, i18n.T(i18n.UserNotFoundText), &gotgbot.SendMessageOpts{})
+			if receiverUser == nil {
+				linkKey, createdAt, err := readUserLinkKey(args[1])
 				if err != nil {
-					return fmt.Errorf("failed to send wrong link response: %w", err)
+					return fmt.Errorf("failed to read the link key: %w", err)
+				}
+				receiverUser, err = r.userRepo.ReadUserByLinkKey(linkKey, createdAt)
+				if receiverUser == nil || err != nil {
+					fmt.Println("failed to retrieve the link owner:", err)
+					_, err = b.SendMessage(ctx.EffectiveChat.Id, r.locale.T(i18n.UserNotFoundText), &gotgbot.SendMessageOpts{})
+					if err != nil {
+						return fmt.Errorf("failed to send wrong link response: %w", err)
+					}
+					return nil
 				}
-				return nil
 			}
 			identity = args[1]
 		}
 
 		if receiverUser.UUID == r.user.UUID {
-			_, err = b.SendMessage(ctx.EffectiveChat.Id, i18n.T(i18n.MessageToYourselfTextText), &gotgbot.SendMessageOpts{})
+			_, err = b.SendMessage(ctx.EffectiveChat.Id, r.locale.T(i18n.MessageToYourselfTextText), &gotgbot.SendMessageOpts{})
 			if err != nil {
 				return fmt.Errorf("failed to send bot info: %w", err)
 			}
@@ -81,25 +76,32 @@ func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
 		}
 
 		// Check if they block each other
-		blockedBy := blockCheck(r.user, receiverUser)
+		blockedBy, err := r.blockCheck(r.user, receiverUser)
+		if err != nil {
+			return fmt.Errorf("failed to check blocks: %w", err)
+		}
 		if blockedBy != None {
 			var reason string
 			var keyboard gotgbot.InlineKeyboardMarkup
 			if blockedBy == Sender {
-				reason = i18n.T(i18n.YouHaveBlockedThisUserText)
+				reason = r.locale.T(i18n.YouHaveBlockedThisUserText)
+				unBlockButtonData, err := callbacks.Encode(unBlockData{ContactUUID: receiverUser.UUID})
+				if err != nil {
+					return err
+				}
 				keyboard = gotgbot.InlineKeyboardMarkup{
 					InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
 						{
 							{
-								Text:         i18n.T(i18n.UnblockButtonText),
-								CallbackData: fmt.Sprintf("ub|%s|%d", receiverUser.UUID, 0),
+								Text:         r.locale.T(i18n.UnblockButtonText),
+								CallbackData: unBlockButtonData,
 							},
 						},
 					},
 				}
 
 			} else if blockedBy == Receiver {
-				reason = i18n.T(i18n.ThisUserHasBlockedYouText)
+				reason = r.locale.T(i18n.ThisUserHasBlockedYouText)
 			}
 
 			_, err = ctx.EffectiveMessage.Reply(b, reason, &gotgbot.SendMessageOpts{
@@ -113,77 +115,100 @@ func (r *RootHandler) start(b *gotgbot.Bot, ctx *ext.Context) error {
 			return nil
 		}
 
-		// Set user state to sending
-		err = r.userRepo.UpdateUser(r.user, map[string]interface{}{
-			"State":       users.Sending,
-			"ContactUUID": receiverUser.UUID,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to update user state: %w", err)
+		// Receivers who blocked the bot or left Telegram would never see the message
+		if receiverUser.Inactive {
+			_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.ReceiverInactiveText), nil)
+			if err != nil {
+				return fmt.Errorf("failed to send inactive receiver message: %w", err)
+			}
+			return nil
 		}
 
-		_, err = b.SendMessage(ctx.EffectiveChat.Id, fmt.Sprintf(i18n.T(i18n.InitialSendMessagePromptText), identity), &gotgbot.SendMessageOpts{})
-		if err != nil {
-			return fmt.Errorf("failed to send bot info: %w", err)
-		}
+		return sendingStep.start(r, b, ctx.EffectiveChat.Id, sendingPayload{
+			ContactUUID: receiverUser.UUID,
+			Recipient:   identity,
+		})
 	}
 
 	return nil
 }
 
-func (r *RootHandler) info(b *gotgbot.Bot, ctx *ext.Context) error {
+func (r *RequestContext) info(b *gotgbot.Bot, ctx *ext.Context) error {
 	_, err := b.SendMessage(ctx.EffectiveChat.Id, "Bugfloyd Anonymous bot\n\nSource code:\nhttps://github.com/bugfloyd/anonymous-telegram-bot", &gotgbot.SendMessageOpts{})
 	if err != nil {
 		return fmt.Errorf("failed to send bot info: %w", err)
 	}
-	err = r.userRepo.ResetUserState(r.user)
+	return nil
+}
+
+func (r *RequestContext) getLink(b *gotgbot.Bot, ctx *ext.Context) error {
+	links, err := userLinks(b, r.user)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s\n%s", r.locale.T(i18n.LinkText), links.Generic)
+	if links.Username != "" {
+		link = fmt.Sprintf("%s\n\n%s\n\n%s", link, r.locale.T(i18n.OrText), links.Username)
+	}
+	if links.Slug != "" {
+		link = fmt.Sprintf("%s\n\n%s\n\n%s", link, r.locale.T(i18n.OrText), links.Slug)
+	}
+	_, err = ctx.EffectiveMessage.Reply(b, link, nil)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *RootHandler) getLink(b *gotgbot.Bot, ctx *ext.Context) error {
+// inboxLinks are the links leading to the inbox of a user
+type inboxLinks struct {
+	Generic  string
+	Username string
+	Slug     string
+}
+
+// All returns the links the user has, the generic link first
+func (l inboxLinks) All() []string {
+	links := []string{l.Generic}
+	if l.Username != "" {
+		links = append(links, l.Username)
+	}
+	if l.Slug != "" {
+		links = append(links, l.Slug)
+	}
+	return links
+}
+
+// userLinks returns the generic link of the user and the username and vanity links if the user has them
+func userLinks(b *gotgbot.Bot, user *users.User) (inboxLinks, error) {
 	s, _ := sqids.New(sqids.Options{
 		Alphabet: secrets.SqidsAlphabet,
 	})
-	genericLinkKey, err := s.Encode([]uint64{uint64(r.user.LinkKey), uint64(r.user.CreatedAt.Unix())})
+	genericLinkKey, err := s.Encode([]uint64{uint64(user.LinkKey), uint64(user.CreatedAt.Unix())})
 	if err != nil {
-		return err
+		return inboxLinks{}, err
 	}
 
-	var link string
-	genericLink := fmt.Sprintf("https://t.me/%s?start=%s", b.User.Username, genericLinkKey)
-	if r.user.Username != "" {
-		usernameLink := fmt.Sprintf("https://t.me/%s?start=_%s", b.User.Username, r.user.Username)
-		link = fmt.Sprintf("%s\n%s\n\n%s\n\n%s", i18n.T(i18n.LinkText), usernameLink, i18n.T(i18n.OrText), genericLink)
-	} else {
-		link = fmt.Sprintf("%s\n%s", i18n.T(i18n.LinkText), genericLink)
+	links := inboxLinks{
+		Generic: startLink(b, genericLinkKey),
 	}
-	_, err = ctx.EffectiveMessage.Reply(b, link, nil)
-	if err != nil {
-		return err
+	if user.Username != "" {
+		links.Username = startLink(b, usernames.LinkPayload(user.Username))
 	}
-	err = r.userRepo.ResetUserState(r.user)
-	if err != nil {
-		return err
+	if user.Slug != "" {
+		links.Slug = startLink(b, user.Slug)
 	}
-	return nil
+	return links, nil
 }
 
-func (r *RootHandler) processText(b *gotgbot.Bot, ctx *ext.Context) error {
-	switch r.user.State {
-	case users.Sending:
-		return r.sendAnonymousMessage(b, ctx)
-	case users.SettingUsername:
-		return r.setUsername(b, ctx)
-	default:
-		return r.sendError(b, ctx, i18n.T(i18n.InvalidCommandText))
-	}
+// startLink returns the deep link starting the bot with the given payload
+func startLink(b *gotgbot.Bot, payload string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", b.User.Username, payload)
 }
 
-func (r *RootHandler) sendError(b *gotgbot.Bot, ctx *ext.Context, message string) error {
-	errorMessage := fmt.Sprintf(i18n.T(i18n.ErrorText), message)
+func (r *RequestContext) sendError(b *gotgbot.Bot, ctx *ext.Context, message string) error {
+	errorMessage := r.locale.T(i18n.ErrorText, i18n.Args{"error": message})
 	_, err := ctx.EffectiveMessage.Reply(b, errorMessage, nil)
 	if err != nil {
 		return fmt.Errorf("failed to send error message: %w", err)
@@ -191,6 +216,7 @@ func (r *RootHandler) sendError(b *gotgbot.Bot, ctx *ext.Context, message string
 	return nil
 }
 
+// readUserLinkKey returns the link key and creation time a generic link key was generated from
 func readUserLinkKey(link string) (int32, int64, error) {
 	s, err := sqids.New(sqids.Options{
 		Alphabet: secrets.SqidsAlphabet,
@@ -204,5 +230,10 @@ func readUserLinkKey(link string) (int32, int64, error) {
 	if len(numbers) != 2 {
 		return 0, 0, fmt.Errorf("failed to read user link key")
 	}
+	// Many strings decode into two numbers, only the one userLinks generates for them is a link key
+	canonical, err := s.Encode(numbers)
+	if err != nil || canonical != link {
+		return 0, 0, fmt.Errorf("failed to read user link key: not a generated key")
+	}
 	return int32(numbers[0]), int64(numbers[1]), nil
 }
@@ -1,38 +1,17 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"log"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
-)
-
-type Command string
-type CallbackCommand string
-
-const (
-	StartCommand      Command = "start"
-	InfoCommand       Command = "info"
-	LinkCommand       Command = "link"
-	UsernameCommand   Command = "username"
-	LanguageCommand   Command = "language"
-	UnBlockAllCommand Command = "unblockall"
-	TextMessage       Command = "text"
-)
-
-const (
-	ReplyCallback          CallbackCommand = "reply-callback"
-	BlockCallback          CallbackCommand = "block-callback"
-	UnBlockCallback        CallbackCommand = "unblock-callback"
-	OpenCallback           CallbackCommand = "open-callback"
-	SetUsernameCallback    CallbackCommand = "set-username-callback"
-	RemoveUsernameCallback CallbackCommand = "remove-username-callback"
-	CancelUsernameCallback CallbackCommand = "cancel-username-callback"
-	SetLanguageCallback    CallbackCommand = "set-language-callback"
-	CancelLanguageCallback CallbackCommand = "cancel-language-callback"
+	"github.com/guregu/dynamo"
 )
 
 type BlockedBy string
@@ -43,88 +22,168 @@ const (
 	None     BlockedBy = "none"
 )
 
-type RootHandler struct {
-	user     *users.User
-	userRepo users.UserRepository
+// RequestContext carries the user, repositories and localizer of a single
+// update. A new one is created for every update and passed to its handler so
+// concurrent updates never share state.
+type RequestContext struct {
+	user        *users.User
+	userRepo    *users.UserRepository
+	blockRepo   *users.BlockRepository
+	messageRepo *users.MessageRepository
+	jobRepo     *users.JobRepository
+	locale      i18n.Localizer
 }
 
-func NewRootHandler() *RootHandler {
-	return &RootHandler{}
-}
-
-func (r *RootHandler) init(commandName interface{}) handlers.Response {
+// newHandler returns the dispatcher response serving the update with the first
+// of the candidate routes accepting the user
+func newHandler(candidates ...route) handlers.Response {
 	return func(b *gotgbot.Bot, ctx *ext.Context) error {
-		return r.runCommand(b, ctx, commandName)
+		r, err := newRequestContext(ctx)
+		if err != nil {
+			return err
+		}
+		return r.runRoute(b, ctx, candidates)
 	}
 }
 
-func (r *RootHandler) runCommand(b *gotgbot.Bot, ctx *ext.Context, command interface{}) error {
-	// create user repo
-	userRepo, err := users.NewUserRepository()
+func newRequestContext(ctx *ext.Context) (*RequestContext, error) {
+	r, err := newRepositories(users.NewDB())
 	if err != nil {
-		return fmt.Errorf("failed to init db repo: %w", err)
+		return nil, err
 	}
-	user, err := r.processUser(userRepo, ctx)
+	user, err := processUser(r.userRepo, ctx)
 
 	if err != nil || user == nil {
-		return fmt.Errorf("failed to process user: %w", err)
+		return nil, fmt.Errorf("failed to process user: %w", err)
+	}
+
+	err = r.blockRepo.MigrateBlacklist(r.userRepo, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate blacklist: %w", err)
+	}
+
+	r.setUser(user, ctx.EffectiveUser.LanguageCode)
+	return r, nil
+}
+
+// newUserRequestContext returns the context of work done for the user outside
+// of an update, like a job coming due
+func newUserRequestContext(db *dynamo.DB, userUUID string) (*RequestContext, error) {
+	r, err := newRepositories(db)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.userRepo.ReadUserByUUID(userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.setUser(user, "")
+	return r, nil
+}
+
+// newRepositories returns a context with the repositories on the connection and no user yet
+func newRepositories(db *dynamo.DB) (*RequestContext, error) {
+	// create user repo
+	userRepo, err := users.NewUserRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init db repo: %w", err)
+	}
+	blockRepo, err := users.NewBlockRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init block repo: %w", err)
+	}
+	messageRepo, err := users.NewMessageRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init message repo: %w", err)
 	}
+	jobRepo, err := users.NewJobRepository(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init job repo: %w", err)
+	}
+
+	return &RequestContext{
+		userRepo:    userRepo,
+		blockRepo:   blockRepo,
+		messageRepo: messageRepo,
+		jobRepo:     jobRepo,
+	}, nil
+}
+
+func (r *RequestContext) setUser(user *users.User, clientLanguage string) {
 	r.user = user
-	r.userRepo = *userRepo
-	i18n.SetLocale(user.Language, ctx.EffectiveUser.LanguageCode)
-
-	switch c := command.(type) {
-	case Command:
-		switch c {
-		case StartCommand:
-			return r.start(b, ctx)
-		case InfoCommand:
-			return r.info(b, ctx)
-		case LinkCommand:
-			return r.getLink(b, ctx)
-		case UsernameCommand:
-			return r.manageUsername(b, ctx)
-		case LanguageCommand:
-			return r.manageLanguage(b, ctx)
-		case TextMessage:
-			return r.processText(b, ctx)
-		case UnBlockAllCommand:
-			return r.unBlockAll(b, ctx)
-		default:
-			return fmt.Errorf("unknown command: %s", c)
+	r.locale = i18n.NewLocalizer(user.Language, clientLanguage).In(user.Location())
+}
+
+func processUser(userRepo *users.UserRepository, ctx *ext.Context) (*users.User, error) {
+	user, err := userRepo.ReadUserByUserId(ctx.EffectiveUser.Id)
+	if err != nil {
+		user, err = userRepo.CreateUser(ctx.EffectiveUser.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A user marked inactive since the bot couldn't reach them is back
+	if user.Inactive {
+		err = userRepo.UpdateUser(user, map[string]interface{}{
+			"Inactive": false,
+		})
+		if err != nil {
+			return nil, err
 		}
-	case CallbackCommand:
-		// Reset user state if necessary
-		if r.user.State != users.Idle || r.user.ContactUUID != "" || r.user.ReplyMessageID != 0 {
-			err := r.userRepo.ResetUserState(r.user)
+	}
+
+	return user, nil
+}
+
+func (r *RequestContext) runRoute(b *gotgbot.Bot, ctx *ext.Context, candidates []route) error {
+	// A flow the user left waiting for too long is over. A message it would
+	// have taken is explained instead of surprising anyone by being acted on.
+	if r.user.StateExpired() {
+		expired, _ := matchRoute(candidates, r.user.State)
+		err := r.userRepo.ResetUserState(r.user)
+		if err != nil {
+			return err
+		}
+		if expired.expired != "" {
+			_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(expired.expired), nil)
 			if err != nil {
-				return err
+				return fmt.Errorf("failed to send state expired message: %w", err)
 			}
+			return nil
 		}
+	}
+
+	rt, ok := matchRoute(candidates, r.user.State)
+	if !ok || (rt.admin && !isAdmin(ctx.EffectiveUser.Id)) {
+		return r.sendError(b, ctx, r.locale.T(i18n.InvalidCommandText))
+	}
 
-		switch c {
-		case ReplyCallback:
-			return r.replyCallback(b, ctx)
-		case BlockCallback:
-			return r.blockCallback(b, ctx)
-		case UnBlockCallback:
-			return r.unBlockCallback(b, ctx)
-		case OpenCallback:
-			return r.openCallback(b, ctx)
-		case SetUsernameCallback:
-			return r.usernameCallback(b, ctx, "SET")
-		case RemoveUsernameCallback:
-			return r.usernameCallback(b, ctx, "REMOVE")
-		case CancelUsernameCallback:
-			return r.usernameCallback(b, ctx, "CANCEL")
-		case SetLanguageCallback:
-			return r.languageCallback(b, ctx, "SET")
-		case CancelLanguageCallback:
-			return r.languageCallback(b, ctx, "CANCEL")
-		default:
-			return fmt.Errorf("unknown command: %s", c)
+	// Reset user state if necessary
+	if rt.resetState && r.user.State != users.Idle {
+		err := r.userRepo.ResetUserState(r.user)
+		if err != nil {
+			return err
 		}
-	default:
-		return fmt.Errorf("unknown command: %s", command)
 	}
+
+	err := rt.handle(r, b, ctx)
+	if errors.Is(err, callbacks.ErrInvalid) && ctx.CallbackQuery != nil {
+		log.Println("expired button:", err)
+		return r.buttonExpired(b, ctx.CallbackQuery)
+	}
+	return err
+}
+
+// buttonExpired answers the callback of a button whose data can't be decoded anymore
+func (r *RequestContext) buttonExpired(b *gotgbot.Bot, cb *gotgbot.CallbackQuery) error {
+	_, err := cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text:      r.locale.T(i18n.ButtonExpiredText),
+		ShowAlert: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,168 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"strings"
+)
+
+type routeHandler func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context) error
+
+// route declares which updates reach a handler. A route handles either a
+// command, a callback or, when neither is set, the messages sent by users in
+// one of its states.
+type route struct {
+	// command is the command name without the leading slash
+	command string
+	// callback is the name of the callback data, the part before the first "|"
+	callback string
+	// states limits the route to users in one of these states, any state if empty
+	states []users.State
+	// resetState returns the user to the idle state before handling the update
+	resetState bool
+	// expired is sent instead of handling a message which arrives after the
+	// state of the route timed out
+	expired i18n.TextID
+	// description is shown for the command in the Telegram command menu, which
+	// leaves out commands without one
+	description i18n.TextID
+	// admin limits the route to the users listed in ADMIN_USER_IDS
+	admin  bool
+	handle routeHandler
+}
+
+// routes is the single table every update is registered and dispatched from.
+// It is filled in init since the command menu sync it serves reads it back.
+var routes []route
+
+func init() {
+	routes = []route{
+		// Commands
+		{command: "start", description: i18n.StartCommandText, handle: (*RequestContext).start},
+		{command: "cancel", description: i18n.CancelCommandText, handle: (*RequestContext).cancel},
+		{command: "info", description: i18n.InfoCommandText, resetState: true, handle: (*RequestContext).info},
+		{command: "link", description: i18n.LinkCommandText, resetState: true, handle: (*RequestContext).getLink},
+		{command: "settings", description: i18n.SettingsCommandText, resetState: true, handle: openSettings(settingsRootPage)},
+		{command: "username", description: i18n.UsernameCommandText, handle: openSettings(settingsUsernamePage)},
+		{command: "slug", description: i18n.SlugCommandText, handle: openSettings(settingsLinksPage)},
+		{command: "timezone", description: i18n.TimezoneCommandText, handle: openSettings(settingsTimezonePage)},
+		{command: "language", description: i18n.LanguageCommandText, handle: openSettings(settingsLanguagePage)},
+		{command: "unblockall", description: i18n.UnblockAllCommandText, handle: (*RequestContext).unBlockAll},
+		{command: "blocked", description: i18n.BlockedCommandText, resetState: true, handle: (*RequestContext).listBlocked},
+		{command: "scheduled", description: i18n.ScheduledCommandText, resetState: true, handle: (*RequestContext).listScheduled},
+		{command: "export", description: i18n.ExportCommandText, resetState: true, handle: (*RequestContext).exportUserData},
+		{command: "deleteme", description: i18n.DeleteMeCommandText, resetState: true, handle: (*RequestContext).deleteMe},
+		{command: "synccommands", description: i18n.SyncCommandsCommandText, admin: true, resetState: true, handle: (*RequestContext).syncCommands},
+
+		// Messages
+		sendingStep.route(),
+		usernameStep.route(),
+		slugStep.route(),
+		timezoneStep.route(),
+
+		// Callbacks
+		{callback: replyButton, resetState: true, handle: (*RequestContext).replyCallback},
+		{callback: blockButton, resetState: true, handle: (*RequestContext).blockCallback},
+		{callback: unBlockButton, resetState: true, handle: (*RequestContext).unBlockCallback},
+		{callback: openButton, resetState: true, handle: (*RequestContext).openCallback},
+		{callback: blockedPageButton, resetState: true, handle: (*RequestContext).blockedPageCallback},
+		{callback: blockedUnblockButton, resetState: true, handle: (*RequestContext).blockedUnblockCallback},
+		{callback: blockDurationButton, resetState: true, handle: (*RequestContext).blockDurationCallback},
+		{callback: blockCancelButton, resetState: true, handle: (*RequestContext).blockCancelCallback},
+		{callback: confirmDeleteButton, resetState: true, handle: withAction((*RequestContext).deleteAccountCallback, "CONFIRM")},
+		{callback: deleteAccountButton, resetState: true, handle: withAction((*RequestContext).deleteAccountCallback, "DELETE")},
+		{callback: cancelDeleteButton, resetState: true, handle: withAction((*RequestContext).deleteAccountCallback, "CANCEL")},
+		{callback: setUsernameButton, resetState: true, handle: withAction((*RequestContext).usernameCallback, "SET")},
+		{callback: removeUsernameButton, resetState: true, handle: withAction((*RequestContext).usernameCallback, "REMOVE")},
+		{callback: cancelUsernameButton, resetState: true, handle: withAction((*RequestContext).usernameCallback, "CANCEL")},
+		{callback: setSlugButton, resetState: true, handle: withAction((*RequestContext).slugCallback, "SET")},
+		{callback: removeSlugButton, resetState: true, handle: withAction((*RequestContext).slugCallback, "REMOVE")},
+		{callback: cancelSlugButton, resetState: true, handle: withAction((*RequestContext).slugCallback, "CANCEL")},
+		{callback: setTimezoneButton, resetState: true, handle: withAction((*RequestContext).timezoneCallback, "SET")},
+		{callback: removeTimezoneButton, resetState: true, handle: withAction((*RequestContext).timezoneCallback, "REMOVE")},
+		{callback: cancelTimezoneButton, resetState: true, handle: withAction((*RequestContext).timezoneCallback, "CANCEL")},
+		{callback: sendDraftButton, handle: (*RequestContext).sendDraftCallback},
+		{callback: discardDraftButton, handle: (*RequestContext).discardDraftCallback},
+		{callback: undoSendButton, handle: (*RequestContext).undoSendCallback},
+		{callback: startScheduleButton, handle: (*RequestContext).startScheduleCallback},
+		{callback: schedulePickerButton, handle: (*RequestContext).schedulePickerCallback},
+		{callback: cancelScheduleButton, handle: (*RequestContext).cancelScheduleCallback},
+		{callback: settingsMenuButton, resetState: true, handle: menuCallback(settingsMenu)},
+		{callback: closeMenuButton, resetState: true, handle: (*RequestContext).closeMenuCallback},
+		{callback: setLanguageButton, resetState: true, handle: withAction((*RequestContext).languageCallback, "SET")},
+		{callback: cancelLanguageButton, resetState: true, handle: withAction((*RequestContext).languageCallback, "CANCEL")},
+	}
+}
+
+// withAction adapts a handler serving several buttons to the route handler of one of them
+func withAction(handle func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context, action string) error, action string) routeHandler {
+	return func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context) error {
+		return handle(r, b, ctx, action)
+	}
+}
+
+// registerRoutes adds a dispatcher handler for every command and callback
+// route and a single handler for all the message routes
+func registerRoutes(dispatcher *ext.Dispatcher) {
+	commands := make(map[string]bool)
+	callbacks := make(map[string]bool)
+	var messageRoutes []route
+
+	for _, rt := range routes {
+		switch {
+		case rt.command != "":
+			if commands[rt.command] {
+				panic(fmt.Sprintf("duplicate command route: %s", rt.command))
+			}
+			commands[rt.command] = true
+			dispatcher.AddHandler(handlers.NewCommand(rt.command, newHandler(rt)))
+		case rt.callback != "":
+			if callbacks[rt.callback] {
+				panic(fmt.Sprintf("duplicate callback route: %s", rt.callback))
+			}
+			callbacks[rt.callback] = true
+			dispatcher.AddHandler(handlers.NewCallback(callbackName(rt.callback), newHandler(rt)))
+		default:
+			messageRoutes = append(messageRoutes, rt)
+		}
+	}
+
+	// Messages are registered last so commands take precedence
+	dispatcher.AddHandler(handlers.NewMessage(CustomSendMessageFilter, newHandler(messageRoutes...)))
+}
+
+// callbackName matches the callbacks whose data has the given name. Unlike a
+// prefix match, "u" does not match "ub|..." so the handler order doesn't matter.
+func callbackName(name string) filters.CallbackQuery {
+	return func(cq *gotgbot.CallbackQuery) bool {
+		dataName, _, _ := strings.Cut(cq.Data, "|")
+		return dataName == name
+	}
+}
+
+// matchRoute returns the first route accepting a user in the given state
+func matchRoute(candidates []route, state users.State) (route, bool) {
+	for _, rt := range candidates {
+		if rt.accepts(state) {
+			return rt, true
+		}
+	}
+	return route{}, false
+}
+
+func (rt route) accepts(state users.State) bool {
+	if len(rt.states) == 0 {
+		return true
+	}
+	for _, s := range rt.states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,414 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/schedule"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"strings"
+	"time"
+)
+
+// startScheduleCallback lets the sender schedule the message they are about to write
+func (r *RequestContext) startScheduleCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	if r.user.State != users.Sending || r.user.StateExpired() {
+		return fmt.Errorf("%w: no message is being written", callbacks.ErrInvalid)
+	}
+	var payload sendingPayload
+	err := r.user.StatePayload(&payload)
+	if err != nil {
+		return fmt.Errorf("failed to read sending state payload: %w", err)
+	}
+
+	payload.Scheduling = true
+	payload.DraftMessageID = 0
+	err = r.userRepo.SetState(r.user, users.Sending, payload, time.Now().Add(sendingTTL))
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	_, err = cb.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	_, _, err = cb.Message.EditText(b, r.locale.T(i18n.WriteScheduledMessageText), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update prompt message: %w", err)
+	}
+	return nil
+}
+
+// pickScheduleTime keeps the message as the draft of the sender and shows the
+// picker of the time it is delivered at
+func (r *RequestContext) pickScheduleTime(b *gotgbot.Bot, ctx *ext.Context, payload sendingPayload) error {
+	payload.DraftMessageID = ctx.EffectiveMessage.MessageId
+	err := r.userRepo.SetState(r.user, users.Sending, payload, time.Now().Add(sendingTTL))
+	if err != nil {
+		return fmt.Errorf("failed to update user state: %w", err)
+	}
+
+	month := r.locale.MonthOf(time.Now())
+	text, buttons, err := r.renderSchedulePicker(schedulePickerData{
+		MessageID: payload.DraftMessageID,
+		Step:      scheduleMonthStep,
+		Year:      month.Year,
+		Month:     month.Month,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send schedule picker: %w", err)
+	}
+	return nil
+}
+
+func (r *RequestContext) schedulePickerCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data schedulePickerData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+	if data.Step == scheduleNoopStep {
+		_, err = cb.Answer(b, nil)
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+		return nil
+	}
+
+	payload, err := r.pendingDraft(data.MessageID)
+	if err != nil {
+		return err
+	}
+
+	var answer string
+	if data.Step == scheduleMinuteStep {
+		days := r.locale.MonthDays(i18n.CalendarMonth{Year: data.Year, Month: data.Month})
+		if data.Day < 1 || data.Day > len(days) {
+			return fmt.Errorf("%w: month %d-%d has no day %d", callbacks.ErrInvalid, data.Year, data.Month, data.Day)
+		}
+		day := days[data.Day-1]
+		dueAt := time.Date(day.Year(), day.Month(), day.Day(), data.Hour, data.Minute, 0, 0, day.Location())
+		if dueAt.After(time.Now()) {
+			return r.scheduleMessage(b, cb, payload, dueAt)
+		}
+		// The time passed while the sender was picking it
+		answer = r.locale.T(i18n.SchedulePassedText)
+		data.Step = scheduleDayStep
+	}
+
+	text, buttons, err := r.renderSchedulePicker(data)
+	if err != nil {
+		return err
+	}
+	_, _, err = cb.Message.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons},
+	})
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return fmt.Errorf("failed to update schedule picker: %w", err)
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text:      answer,
+		ShowAlert: answer != "",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	return nil
+}
+
+// scheduleMessage queues the draft of the sender to be delivered at the picked time
+func (r *RequestContext) scheduleMessage(b *gotgbot.Bot, cb *gotgbot.CallbackQuery, payload sendingPayload, dueAt time.Time) error {
+	job := users.NewJob(r.user, users.ScheduledMessageJob, dueAt)
+	err := job.SetPayload(deliveryPayload{
+		Sending: sendingPayload{
+			ContactUUID:    payload.ContactUUID,
+			ReplyMessageID: payload.ReplyMessageID,
+		},
+		MessageID: payload.DraftMessageID,
+	})
+	if err != nil {
+		return err
+	}
+	err = r.jobRepo.CreateJob(job)
+	if err != nil {
+		return err
+	}
+
+	err = r.userRepo.ResetUserState(r.user)
+	if err != nil {
+		return err
+	}
+
+	_, err = cb.Answer(b, nil)
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	_, _, err = cb.Message.EditText(b, r.locale.T(i18n.ScheduledText, i18n.Args{"time": r.locale.DateTime(dueAt)}), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule picker: %w", err)
+	}
+	return nil
+}
+
+// renderSchedulePicker returns the page of the picker for the step of the
+// data: the days of a month, the hours of a day or the minutes of an hour. The
+// month and day are in the calendar of the language of the sender.
+func (r *RequestContext) renderSchedulePicker(data schedulePickerData) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	location := r.user.Location()
+	now := time.Now().In(location)
+	month := i18n.CalendarMonth{Year: data.Year, Month: data.Month}
+	if !schedule.MonthAllowed(month, r.locale.MonthOf(now)) {
+		return "", nil, fmt.Errorf("%w: month %d-%d can't be scheduled in", callbacks.ErrInvalid, data.Year, data.Month)
+	}
+	days := r.locale.MonthDays(month)
+
+	var buttons [][]gotgbot.InlineKeyboardButton
+	var text string
+	var err error
+	switch data.Step {
+	case scheduleMonthStep:
+		text = r.locale.T(i18n.PickScheduleDayText, i18n.Args{"timezone": location.String()})
+		buttons, err = r.renderCalendar(data, month, days, now)
+	case scheduleDayStep, scheduleHourStep:
+		day, err := pickedDay(data, days, now)
+		if err != nil {
+			return "", nil, err
+		}
+		text = r.locale.T(i18n.PickScheduleTimeText, i18n.Args{"date": r.locale.Date(day)})
+
+		var row []gotgbot.InlineKeyboardButton
+		if data.Step == scheduleDayStep {
+			// Hours of the day, 6 per row
+			for _, hour := range schedule.Hours(day, now) {
+				button, err := callbackButton(r.locale.Clock(hour, 0), data.at(scheduleHourStep, data.Day, hour, 0))
+				if err != nil {
+					return "", nil, err
+				}
+				row = append(row, button)
+				if len(row) == 6 {
+					buttons = append(buttons, row)
+					row = nil
+				}
+			}
+		} else {
+			for _, t := range schedule.Times(day, data.Hour, now) {
+				button, err := callbackButton(r.locale.Clock(data.Hour, t.Minute()), data.at(scheduleMinuteStep, data.Day, data.Hour, t.Minute()))
+				if err != nil {
+					return "", nil, err
+				}
+				row = append(row, button)
+			}
+		}
+		if len(row) > 0 {
+			buttons = append(buttons, row)
+		}
+
+		backStep := scheduleMonthStep
+		if data.Step == scheduleHourStep {
+			backStep = scheduleDayStep
+		}
+		backButton, err := callbackButton(r.locale.T(i18n.BackButtonText), data.at(backStep, data.Day, 0, 0))
+		if err != nil {
+			return "", nil, err
+		}
+		buttons = append(buttons, []gotgbot.InlineKeyboardButton{backButton})
+	default:
+		return "", nil, fmt.Errorf("%w: unknown schedule step %s", callbacks.ErrInvalid, data.Step)
+	}
+	return text, buttons, err
+}
+
+// pickedDay returns the start of the day of the month the data picked, if a
+// message can still be scheduled on it
+func pickedDay(data schedulePickerData, days []time.Time, now time.Time) (time.Time, error) {
+	if data.Day < 1 || data.Day > len(days) {
+		return time.Time{}, fmt.Errorf("%w: month %d-%d has no day %d", callbacks.ErrInvalid, data.Year, data.Month, data.Day)
+	}
+	day := days[data.Day-1]
+	if !schedule.DayOpen(day, now) {
+		return time.Time{}, fmt.Errorf("%w: day %s has passed", callbacks.ErrInvalid, day.Format(time.DateOnly))
+	}
+	return day, nil
+}
+
+// renderCalendar returns the days of the month as a grid of weeks starting on
+// the first weekday of the language, with the navigation to the neighbouring
+// months above it
+func (r *RequestContext) renderCalendar(data schedulePickerData, month i18n.CalendarMonth, days []time.Time, now time.Time) ([][]gotgbot.InlineKeyboardButton, error) {
+	var buttons [][]gotgbot.InlineKeyboardButton
+
+	// Month navigation
+	current := r.locale.MonthOf(now)
+	monthButton := func(label string, offset int) (gotgbot.InlineKeyboardButton, error) {
+		target := month.AddMonths(offset)
+		if !schedule.MonthAllowed(target, current) {
+			return callbackButton(" ", noopPick)
+		}
+		next := data
+		next.Step, next.Year, next.Month = scheduleMonthStep, target.Year, target.Month
+		return callbackButton(label, next)
+	}
+	previous, err := monthButton("‹", -1)
+	if err != nil {
+		return nil, err
+	}
+	label, err := callbackButton(r.locale.MonthTitle(month), noopPick)
+	if err != nil {
+		return nil, err
+	}
+	following, err := monthButton("›", 1)
+	if err != nil {
+		return nil, err
+	}
+	buttons = append(buttons, []gotgbot.InlineKeyboardButton{previous, label, following})
+
+	var weekdays []gotgbot.InlineKeyboardButton
+	for _, weekday := range r.locale.Weekdays() {
+		button, err := callbackButton(weekday, noopPick)
+		if err != nil {
+			return nil, err
+		}
+		weekdays = append(weekdays, button)
+	}
+	buttons = append(buttons, weekdays)
+
+	// Blanks before the first day, the first weekday being the first column
+	var week []gotgbot.InlineKeyboardButton
+	for i := 0; i < (int(days[0].Weekday())-int(r.locale.FirstWeekday())+7)%7; i++ {
+		blank, err := callbackButton(" ", noopPick)
+		if err != nil {
+			return nil, err
+		}
+		week = append(week, blank)
+	}
+	for i, day := range days {
+		var button gotgbot.InlineKeyboardButton
+		if !schedule.DayOpen(day, now) {
+			button, err = callbackButton("·", noopPick)
+		} else {
+			button, err = callbackButton(r.locale.Number(int64(i+1)), data.at(scheduleDayStep, i+1, 0, 0))
+		}
+		if err != nil {
+			return nil, err
+		}
+		week = append(week, button)
+		if len(week) == 7 {
+			buttons = append(buttons, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		for len(week) < 7 {
+			blank, err := callbackButton(" ", noopPick)
+			if err != nil {
+				return nil, err
+			}
+			week = append(week, blank)
+		}
+		buttons = append(buttons, week)
+	}
+	return buttons, nil
+}
+
+// noopPick is carried by the labels and blanks of the picker
+var noopPick = schedulePickerData{Step: scheduleNoopStep}
+
+// at returns the data of the picker button leading to the step
+func (d schedulePickerData) at(step string, day, hour, minute int) schedulePickerData {
+	d.Step, d.Day, d.Hour, d.Minute = step, day, hour, minute
+	return d
+}
+
+// callbackButton returns a button carrying the payload
+func callbackButton(text string, payload callbacks.Payload) (gotgbot.InlineKeyboardButton, error) {
+	data, err := callbacks.Encode(payload)
+	if err != nil {
+		return gotgbot.InlineKeyboardButton{}, err
+	}
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: data}, nil
+}
+
+// listScheduled shows the pending scheduled messages of the user
+func (r *RequestContext) listScheduled(b *gotgbot.Bot, ctx *ext.Context) error {
+	text, buttons, err := r.renderScheduledList()
+	if err != nil {
+		return err
+	}
+
+	_, err = b.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send scheduled messages: %w", err)
+	}
+	return nil
+}
+
+func (r *RequestContext) renderScheduledList() (string, [][]gotgbot.InlineKeyboardButton, error) {
+	jobs, err := r.jobRepo.ReadOwnerJobs(r.user, users.ScheduledMessageJob)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(jobs) == 0 {
+		return r.locale.T(i18n.NoScheduledMessagesText), nil, nil
+	}
+
+	buttons := make([][]gotgbot.InlineKeyboardButton, 0, len(jobs))
+	for _, job := range jobs {
+		button, err := callbackButton(r.locale.T(i18n.CancelScheduledButtonText, i18n.Args{"time": r.locale.DateTime(job.DueAt)}), cancelScheduleData{JobUUID: job.UUID})
+		if err != nil {
+			return "", nil, err
+		}
+		buttons = append(buttons, []gotgbot.InlineKeyboardButton{button})
+	}
+	return r.locale.T(i18n.ScheduledMessagesText, i18n.Args{"count": len(jobs)}), buttons, nil
+}
+
+func (r *RequestContext) cancelScheduleCallback(b *gotgbot.Bot, ctx *ext.Context) error {
+	cb := ctx.Update.CallbackQuery
+	var data cancelScheduleData
+	err := callbacks.Decode(cb.Data, &data)
+	if err != nil {
+		return err
+	}
+
+	answer := r.locale.T(i18n.CancelledText)
+	err = r.jobRepo.CancelJob(r.user, data.JobUUID)
+	if errors.Is(err, users.ErrJobGone) {
+		answer = r.locale.T(i18n.TooLateToUndoText)
+	} else if err != nil {
+		return err
+	}
+
+	text, buttons, err := r.renderScheduledList()
+	if err != nil {
+		return err
+	}
+	_, _, err = cb.Message.EditText(b, text, &gotgbot.EditMessageTextOpts{
+		ReplyMarkup: gotgbot.InlineKeyboardMarkup{InlineKeyboard: buttons},
+	})
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return fmt.Errorf("failed to update scheduled messages: %w", err)
+	}
+
+	_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text: answer,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to answer callback: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package schedule holds the rules of the times a message can be scheduled at
+package schedule
+
+import (
+	"time"
+
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+)
+
+// MonthsAhead is how many months after the current one messages can be scheduled in
+const MonthsAhead = 12
+
+// Minutes are the minutes of an hour a message can be scheduled at
+var Minutes = []int{0, 15, 30, 45}
+
+// MonthAllowed reports whether messages can be scheduled in the month, given the current month
+func MonthAllowed(month, current i18n.CalendarMonth) bool {
+	ahead := month.Sub(current)
+	return ahead >= 0 && ahead <= MonthsAhead
+}
+
+// Hours returns the hours of the day, given by its start, which have a time
+// still ahead of now
+func Hours(day, now time.Time) []int {
+	var hours []int
+	for hour := 0; hour < 24; hour++ {
+		if len(Times(day, hour, now)) > 0 {
+			hours = append(hours, hour)
+		}
+	}
+	return hours
+}
+
+// Times returns the times of the hour of the day which are still ahead of now
+func Times(day time.Time, hour int, now time.Time) []time.Time {
+	var times []time.Time
+	for _, minute := range Minutes {
+		t := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+		if t.After(now) {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// DayOpen reports whether a message can still be scheduled on the day, given by its start
+func DayOpen(day, now time.Time) bool {
+	return len(Times(day, 23, now)) > 0
+}
@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+)
+
+func TestMonthAllowed(t *testing.T) {
+	current := i18n.CalendarMonth{Year: 2024, Month: 11}
+
+	tests := []struct {
+		month i18n.CalendarMonth
+		want  bool
+	}{
+		{i18n.CalendarMonth{Year: 2024, Month: 10}, false},
+		{i18n.CalendarMonth{Year: 2024, Month: 11}, true},
+		{i18n.CalendarMonth{Year: 2025, Month: 1}, true},
+		{i18n.CalendarMonth{Year: 2025, Month: 11}, true},
+		{i18n.CalendarMonth{Year: 2025, Month: 12}, false},
+		{i18n.CalendarMonth{Year: 2023, Month: 11}, false},
+	}
+
+	for _, test := range tests {
+		if got := MonthAllowed(test.month, current); got != test.want {
+			t.Errorf("MonthAllowed(%v, %v) = %v, want %v", test.month, current, got, test.want)
+		}
+	}
+}
+
+func TestHours(t *testing.T) {
+	tehran, err := time.LoadLocation("Asia/Tehran")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 3, 20, 0, 0, 0, 0, tehran)
+
+	tests := []struct {
+		now  time.Time
+		want []int
+	}{
+		{time.Date(2024, 3, 19, 12, 0, 0, 0, tehran), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}},
+		{time.Date(2024, 3, 20, 21, 40, 0, 0, tehran), []int{21, 22, 23}},
+		{time.Date(2024, 3, 20, 21, 45, 0, 0, tehran), []int{22, 23}},
+		{time.Date(2024, 3, 20, 23, 45, 0, 0, tehran), nil},
+		// The same instant seen from another time zone
+		{time.Date(2024, 3, 20, 18, 10, 0, 0, time.UTC), []int{21, 22, 23}},
+	}
+
+	for _, test := range tests {
+		if got := Hours(day, test.now); !slices.Equal(got, test.want) {
+			t.Errorf("Hours(%v) = %v, want %v", test.now, got, test.want)
+		}
+	}
+}
+
+func TestTimes(t *testing.T) {
+	day := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 3, 20, 9, 15, 0, 0, time.UTC)
+
+	got := Times(day, 9, now)
+	want := []time.Time{
+		time.Date(2024, 3, 20, 9, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 20, 9, 45, 0, 0, time.UTC),
+	}
+	if !slices.EqualFunc(got, want, time.Time.Equal) {
+		t.Errorf("Times(9) = %v, want %v", got, want)
+	}
+	if got := Times(day, 8, now); len(got) != 0 {
+		t.Errorf("Times(8) = %v, want none", got)
+	}
+}
+
+func TestDayOpen(t *testing.T) {
+	now := time.Date(2024, 3, 20, 23, 50, 0, 0, time.UTC)
+
+	tests := []struct {
+		day  time.Time
+		want bool
+	}{
+		{time.Date(2024, 3, 19, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), false},
+		{time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC), true},
+	}
+
+	for _, test := range tests {
+		if got := DayOpen(test.day, now); got != test.want {
+			t.Errorf("DayOpen(%v) = %v, want %v", test.day, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/callbacks"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pages of the settings menu
+const (
+	settingsRootPage          = "settings"
+	settingsUsernamePage      = "username"
+	settingsLanguagePage      = "language"
+	settingsLinksPage         = "links"
+	settingsTimezonePage      = "timezone"
+	settingsNotificationsPage = "notifications"
+	settingsPrivacyPage       = "privacy"
+	settingsSendingPage       = "sending"
+	settingsBlockedPage       = "blocked"
+	settingsUnblockAllPage    = "unblock"
+)
+
+// Actions of the settings menu pages
+const (
+	// setAction starts the flow asking for a new value, its prompt is sent below the menu
+	setAction            = "set"
+	removeAction         = "remove"
+	silentMessagesAction = "silent"
+	readReceiptsAction   = "receipts"
+	confirmSendingAction = "confirm"
+	// sendDelayAction is followed by the undo window in seconds, e.g. "delay10"
+	sendDelayAction  = "delay"
+	unblockAllAction = "unblockall"
+)
+
+// sendDelays are the undo windows in seconds the sending page offers
+var sendDelays = []int{0, 5, 10, 30, 60}
+
+// languageMenuColumns is the number of languages per row of the language page
+const languageMenuColumns = 3
+
+var settingsMenu = menu{
+	settingsRootPage:          {render: (*RequestContext).renderSettings},
+	settingsUsernamePage:      {parent: settingsRootPage, render: (*RequestContext).renderUsernameSettings, act: (*RequestContext).usernameSettingsAction},
+	settingsLanguagePage:      {parent: settingsRootPage, render: (*RequestContext).renderLanguageSettings, act: (*RequestContext).languageSettingsAction},
+	settingsLinksPage:         {parent: settingsRootPage, render: (*RequestContext).renderLinksSettings, act: (*RequestContext).linksSettingsAction},
+	settingsTimezonePage:      {parent: settingsRootPage, render: (*RequestContext).renderTimezoneSettings, act: (*RequestContext).timezoneSettingsAction},
+	settingsNotificationsPage: {parent: settingsRootPage, render: (*RequestContext).renderNotificationsSettings, act: (*RequestContext).notificationsSettingsAction},
+	settingsPrivacyPage:       {parent: settingsRootPage, render: (*RequestContext).renderPrivacySettings, act: (*RequestContext).privacySettingsAction},
+	settingsSendingPage:       {parent: settingsRootPage, render: (*RequestContext).renderSendingSettings, act: (*RequestContext).sendingSettingsAction},
+	settingsBlockedPage:       {parent: settingsRootPage, render: (*RequestContext).renderBlockedSettings, act: (*RequestContext).blockedSettingsAction},
+	settingsUnblockAllPage:    {parent: settingsBlockedPage, render: (*RequestContext).renderUnblockAllSettings},
+}
+
+// openSettings returns the command handler showing a page of the settings menu
+func openSettings(page string) routeHandler {
+	return func(r *RequestContext, b *gotgbot.Bot, ctx *ext.Context) error {
+		return r.sendMenu(b, ctx, settingsMenu, page)
+	}
+}
+
+func (r *RequestContext) renderSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	pages := []struct {
+		id   string
+		text i18n.TextID
+	}{
+		{settingsUsernamePage, i18n.UsernameSettingsButtonText},
+		{settingsLinksPage, i18n.LinksSettingsButtonText},
+		{settingsLanguagePage, i18n.LanguageSettingsButtonText},
+		{settingsTimezonePage, i18n.TimezoneSettingsButtonText},
+		{settingsNotificationsPage, i18n.NotificationsSettingsButtonText},
+		{settingsPrivacyPage, i18n.PrivacySettingsButtonText},
+		{settingsSendingPage, i18n.SendingSettingsButtonText},
+		{settingsBlockedPage, i18n.BlockedSettingsButtonText},
+	}
+
+	var buttons [][]gotgbot.InlineKeyboardButton
+	for i, page := range pages {
+		button, err := menuButton(r.locale.T(page.text), page.id, "")
+		if err != nil {
+			return "", nil, err
+		}
+		if i%2 == 0 {
+			buttons = append(buttons, nil)
+		}
+		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], button)
+	}
+	return r.locale.T(i18n.SettingsText), buttons, nil
+}
+
+func (r *RequestContext) renderUsernameSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	if r.user.Username == "" {
+		setButton, err := menuButton(r.locale.T(i18n.SetUsernameButtonText), settingsUsernamePage, setAction)
+		if err != nil {
+			return "", nil, err
+		}
+		return r.locale.T(i18n.YouDontHaveAUsernameText), [][]gotgbot.InlineKeyboardButton{{setButton}}, nil
+	}
+
+	changeButton, err := menuButton(r.locale.T(i18n.ChangeUsernameButtonText), settingsUsernamePage, setAction)
+	if err != nil {
+		return "", nil, err
+	}
+	removeButton, err := menuButton(r.locale.T(i18n.RemoveUsernameButtonText), settingsUsernamePage, removeAction)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.locale.T(i18n.YourCurrentUsernameText, i18n.Args{"username": r.locale.Isolate(r.user.Username)}), [][]gotgbot.InlineKeyboardButton{
+		{changeButton, removeButton},
+	}, nil
+}
+
+func (r *RequestContext) usernameSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action == setAction {
+		nextChange := usernamePolicy.NextChange(r.user.UsernameChangedAt)
+		if time.Now().Before(nextChange) {
+			return r.locale.T(i18n.UsernameChangeTooSoonText, i18n.Args{"duration": r.locale.Duration(time.Until(nextChange))}), nil
+		}
+		err := usernameStep.start(r, b, r.user.UserID, noPayload{})
+		if err != nil {
+			return "", err
+		}
+		return r.locale.T(i18n.SettingUsernameText), nil
+	}
+	if action != removeAction {
+		return "", fmt.Errorf("%w: unknown username action %s", callbacks.ErrInvalid, action)
+	}
+	if r.user.Username == "" {
+		return "", nil
+	}
+
+	err := r.userRepo.ReleaseUsername(r.user)
+	if err != nil {
+		return "", fmt.Errorf("failed to remove username: %w", err)
+	}
+	return r.locale.T(i18n.UsernameHasBeenRemovedText), nil
+}
+
+func (r *RequestContext) renderLanguageSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	var text string
+	if info, ok := i18n.LookupLanguage(r.user.Language); ok {
+		text = r.locale.T(i18n.YourLanguageText, i18n.Args{"language": info.NativeName})
+	} else {
+		text = r.locale.T(i18n.NoPreferredLanguageSetText)
+	}
+
+	var buttons [][]gotgbot.InlineKeyboardButton
+	for i, language := range i18n.Languages() {
+		name := language.NativeName
+		if language.Code == r.user.Language {
+			name = "✓ " + name
+		}
+		button, err := menuButton(name, settingsLanguagePage, string(language.Code))
+		if err != nil {
+			return "", nil, err
+		}
+		if i%languageMenuColumns == 0 {
+			buttons = append(buttons, nil)
+		}
+		buttons[len(buttons)-1] = append(buttons[len(buttons)-1], button)
+	}
+	return text, buttons, nil
+}
+
+func (r *RequestContext) languageSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	info, ok := i18n.LookupLanguage(i18n.Language(action))
+	if !ok {
+		return "", fmt.Errorf("%w: unknown language %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
+		"Language": info.Code,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update user language: %w", err)
+	}
+
+	// The menu is shown in the newly chosen language from now on
+	r.locale = i18n.NewLocalizer(info.Code, "").In(r.user.Location())
+	return r.locale.T(i18n.LanguageUpdatedSuccessfullyText), nil
+}
+
+func (r *RequestContext) renderLinksSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	links, err := userLinks(b, r.user)
+	if err != nil {
+		return "", nil, err
+	}
+
+	text := fmt.Sprintf("%s\n%s", r.locale.T(i18n.LinkText), links.Generic)
+	if links.Username != "" {
+		text = fmt.Sprintf("%s\n\n%s\n%s", text, r.locale.T(i18n.OrText), links.Username)
+	}
+	if links.Slug == "" {
+		text = fmt.Sprintf("%s\n\n%s", text, r.locale.T(i18n.YouDontHaveASlugText))
+		setButton, err := menuButton(r.locale.T(i18n.SetSlugButtonText), settingsLinksPage, setAction)
+		if err != nil {
+			return "", nil, err
+		}
+		return text, [][]gotgbot.InlineKeyboardButton{{setButton}}, nil
+	}
+
+	text = fmt.Sprintf("%s\n\n%s", text, r.locale.T(i18n.YourCurrentSlugText, i18n.Args{"link": r.locale.Isolate(links.Slug)}))
+	changeButton, err := menuButton(r.locale.T(i18n.ChangeSlugButtonText), settingsLinksPage, setAction)
+	if err != nil {
+		return "", nil, err
+	}
+	removeButton, err := menuButton(r.locale.T(i18n.RemoveSlugButtonText), settingsLinksPage, removeAction)
+	if err != nil {
+		return "", nil, err
+	}
+	return text, [][]gotgbot.InlineKeyboardButton{
+		{changeButton, removeButton},
+	}, nil
+}
+
+func (r *RequestContext) linksSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action == setAction {
+		err := slugStep.start(r, b, r.user.UserID, noPayload{})
+		if err != nil {
+			return "", err
+		}
+		return r.locale.T(i18n.SettingSlugText), nil
+	}
+	if action != removeAction {
+		return "", fmt.Errorf("%w: unknown links action %s", callbacks.ErrInvalid, action)
+	}
+	if r.user.Slug == "" {
+		return "", nil
+	}
+
+	err := r.userRepo.ReleaseSlug(r.user)
+	if err != nil {
+		return "", fmt.Errorf("failed to remove slug: %w", err)
+	}
+	return r.locale.T(i18n.SlugHasBeenRemovedText), nil
+}
+
+func (r *RequestContext) renderTimezoneSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	if r.user.Timezone == "" {
+		setButton, err := menuButton(r.locale.T(i18n.SetTimezoneButtonText), settingsTimezonePage, setAction)
+		if err != nil {
+			return "", nil, err
+		}
+		return r.locale.T(i18n.NoTimezoneText), [][]gotgbot.InlineKeyboardButton{{setButton}}, nil
+	}
+
+	changeButton, err := menuButton(r.locale.T(i18n.ChangeTimezoneButtonText), settingsTimezonePage, setAction)
+	if err != nil {
+		return "", nil, err
+	}
+	removeButton, err := menuButton(r.locale.T(i18n.RemoveTimezoneButtonText), settingsTimezonePage, removeAction)
+	if err != nil {
+		return "", nil, err
+	}
+	text := r.locale.T(i18n.YourTimezoneText, i18n.Args{
+		"timezone": r.user.Timezone,
+		"time":     r.locale.DateTime(time.Now()),
+	})
+	return text, [][]gotgbot.InlineKeyboardButton{
+		{changeButton, removeButton},
+	}, nil
+}
+
+func (r *RequestContext) timezoneSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action == setAction {
+		err := timezoneStep.start(r, b, r.user.UserID, noPayload{})
+		if err != nil {
+			return "", err
+		}
+		return r.locale.T(i18n.SettingTimezoneText), nil
+	}
+	if action != removeAction {
+		return "", fmt.Errorf("%w: unknown timezone action %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
+		"Timezone": "",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to remove timezone: %w", err)
+	}
+	r.locale = r.locale.In(r.user.Location())
+	return r.locale.T(i18n.TimezoneHasBeenRemovedText), nil
+}
+
+// toggleButton returns a button of the page switching a setting on or off
+func (r *RequestContext) toggleButton(text i18n.TextID, on bool, page string, action string) (gotgbot.InlineKeyboardButton, error) {
+	state := r.locale.T(i18n.OffText)
+	if on {
+		state = r.locale.T(i18n.OnText)
+	}
+	return menuButton(r.locale.T(text, i18n.Args{"state": state}), page, action)
+}
+
+func (r *RequestContext) renderNotificationsSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	button, err := r.toggleButton(i18n.SilentMessagesButtonText, r.user.SilentMessages, settingsNotificationsPage, silentMessagesAction)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.locale.T(i18n.NotificationsSettingsText), [][]gotgbot.InlineKeyboardButton{{button}}, nil
+}
+
+func (r *RequestContext) notificationsSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action != silentMessagesAction {
+		return "", fmt.Errorf("%w: unknown notifications action %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
+		"SilentMessages": !r.user.SilentMessages,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update notification settings: %w", err)
+	}
+	return "", nil
+}
+
+func (r *RequestContext) renderPrivacySettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	button, err := r.toggleButton(i18n.ReadReceiptsButtonText, !r.user.HideReadReceipts, settingsPrivacyPage, readReceiptsAction)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.locale.T(i18n.PrivacySettingsText), [][]gotgbot.InlineKeyboardButton{{button}}, nil
+}
+
+func (r *RequestContext) privacySettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action != readReceiptsAction {
+		return "", fmt.Errorf("%w: unknown privacy action %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
+		"HideReadReceipts": !r.user.HideReadReceipts,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	return "", nil
+}
+
+func (r *RequestContext) renderSendingSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	button, err := r.toggleButton(i18n.ConfirmSendingButtonText, r.user.ConfirmSending, settingsSendingPage, confirmSendingAction)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var delayButtons []gotgbot.InlineKeyboardButton
+	for _, delay := range sendDelays {
+		text := r.locale.T(i18n.OffText)
+		if delay > 0 {
+			text = r.locale.T(i18n.SecondsText, i18n.Args{"count": delay})
+		}
+		if delay == r.user.SendDelay {
+			text = "✓ " + text
+		}
+		delayButton, err := menuButton(text, settingsSendingPage, sendDelayAction+strconv.Itoa(delay))
+		if err != nil {
+			return "", nil, err
+		}
+		delayButtons = append(delayButtons, delayButton)
+	}
+
+	return r.locale.T(i18n.SendingSettingsText), [][]gotgbot.InlineKeyboardButton{{button}, delayButtons}, nil
+}
+
+func (r *RequestContext) sendingSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	updates := map[string]interface{}{}
+	if action == confirmSendingAction {
+		updates["ConfirmSending"] = !r.user.ConfirmSending
+	} else if seconds, ok := strings.CutPrefix(action, sendDelayAction); ok {
+		delay, err := strconv.Atoi(seconds)
+		if err != nil || !slices.Contains(sendDelays, delay) {
+			return "", fmt.Errorf("%w: unknown undo window %s", callbacks.ErrInvalid, seconds)
+		}
+		updates["SendDelay"] = delay
+	} else {
+		return "", fmt.Errorf("%w: unknown sending action %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.userRepo.UpdateUser(r.user, updates)
+	if err != nil {
+		return "", fmt.Errorf("failed to update sending settings: %w", err)
+	}
+	return "", nil
+}
+
+func (r *RequestContext) renderBlockedSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	blocks, err := r.blockRepo.ReadBlocks(r.user)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(blocks) == 0 {
+		return r.locale.T(i18n.NoBlockedUsersText), nil, nil
+	}
+
+	var blocked, muted int
+	for _, block := range blocks {
+		if block.IsMuted() {
+			muted++
+		} else {
+			blocked++
+		}
+	}
+
+	listButtonData, err := callbacks.Encode(blockedPageData{Page: 0, Menu: true})
+	if err != nil {
+		return "", nil, err
+	}
+	unblockAllButton, err := menuButton(r.locale.T(i18n.UnblockAllButtonText), settingsUnblockAllPage, "")
+	if err != nil {
+		return "", nil, err
+	}
+	return r.locale.T(i18n.BlockedSettingsText, i18n.Args{"blocked": blocked, "muted": muted}), [][]gotgbot.InlineKeyboardButton{
+		{
+			{
+				Text:         r.locale.T(i18n.ShowBlockedListButtonText),
+				CallbackData: listButtonData,
+			},
+			unblockAllButton,
+		},
+	}, nil
+}
+
+// renderUnblockAllSettings asks to confirm unblocking everyone, going back cancels it
+func (r *RequestContext) renderUnblockAllSettings(b *gotgbot.Bot) (string, [][]gotgbot.InlineKeyboardButton, error) {
+	confirmButton, err := menuButton(r.locale.T(i18n.UnblockAllConfirmButtonText), settingsBlockedPage, unblockAllAction)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.locale.T(i18n.UnblockAllConfirmText), [][]gotgbot.InlineKeyboardButton{{confirmButton}}, nil
+}
+
+func (r *RequestContext) blockedSettingsAction(b *gotgbot.Bot, action string) (string, error) {
+	if action != unblockAllAction {
+		return "", fmt.Errorf("%w: unknown blocked users action %s", callbacks.ErrInvalid, action)
+	}
+
+	err := r.blockRepo.DeleteAllBlocks(r.user)
+	if err != nil {
+		return "", fmt.Errorf("failed to unblock all users: %w", err)
+	}
+	return r.locale.T(i18n.UnblockAllUsersResultText), nil
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/usernames"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"os"
+	"strings"
+	"time"
+)
+
+// slugRedirectWindow is the time a replaced or removed vanity link slug keeps
+// leading to its previous owner, given as a SLUG_REDIRECT_WINDOW duration
+var slugRedirectWindow = usernames.ParseDuration(os.Getenv("SLUG_REDIRECT_WINDOW"), 30*24*time.Hour)
+
+var slugStep = flowStep[noPayload]{
+	state:   users.SettingSlug,
+	ttl:     15 * time.Minute,
+	expired: i18n.StateExpiredText,
+	prompt: func(r *RequestContext, _ noPayload) string {
+		return fmt.Sprintf("%s\n\n%s", r.locale.T(i18n.SlugExplanationText), r.locale.T(i18n.EnterANewSlugText))
+	},
+	validate: func(r *RequestContext, msg *gotgbot.Message, _ noPayload) string {
+		rejection := usernamePolicy.CheckSlug(normalizeSlug(msg.Text))
+		if rejection == usernames.Accepted {
+			// A slug which is the generic link key of a user would shadow their link
+			if _, _, err := readUserLinkKey(normalizeSlug(msg.Text)); err == nil {
+				rejection = usernames.Reserved
+			}
+		}
+		if rejection != usernames.Accepted {
+			return r.slugRejectionText(rejection)
+		}
+		return ""
+	},
+	handle: (*RequestContext).setSlug,
+}
+
+func normalizeSlug(text string) string {
+	return strings.ToLower(strings.TrimSpace(text))
+}
+
+func (r *RequestContext) slugCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
+	cb := ctx.Update.CallbackQuery
+
+	// Remove slug command buttons
+	_, _, err := cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to update slug message markup: %w", err)
+	}
+
+	if action == "CANCEL" {
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.NeverMindButtonText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "SET" {
+		err := slugStep.start(r, b, ctx.EffectiveChat.Id, noPayload{})
+		if err != nil {
+			return err
+		}
+
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.SettingSlugText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "REMOVE" {
+		err := r.userRepo.ReleaseSlug(r.user)
+		if err != nil {
+			return fmt.Errorf("failed to remove slug: %w", err)
+		}
+
+		_, _, err = cb.Message.EditText(b, r.locale.T(i18n.SlugHasBeenRemovedText), &gotgbot.EditMessageTextOpts{})
+		if err != nil {
+			return fmt.Errorf("failed to update slug message text: %w", err)
+		}
+
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.SlugHasBeenRemovedText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RequestContext) setSlug(b *gotgbot.Bot, ctx *ext.Context, _ noPayload) error {
+	slug := normalizeSlug(ctx.EffectiveMessage.Text)
+
+	if slug == r.user.Slug {
+		// Reset sender user
+		err := r.userRepo.ResetUserState(r.user)
+		if err != nil {
+			return err
+		}
+
+		_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.SameSlugText), nil)
+		if err != nil {
+			return fmt.Errorf("failed to send reply message: %w", err)
+		}
+		return nil
+	}
+
+	err := r.userRepo.ClaimSlug(r.user, slug, slugRedirectWindow)
+	if errors.Is(err, users.ErrSlugTaken) {
+		return r.rejectSlug(b, ctx, usernames.Taken)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update slug: %w", err)
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.SlugHasBeenSetText, i18n.Args{"link": r.locale.Isolate(startLink(b, slug))}), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send reply message: %w", err)
+	}
+
+	return nil
+}
+
+// rejectSlug explains why the entered slug was not accepted, the user stays in
+// the setting slug state to enter another one
+func (r *RequestContext) rejectSlug(b *gotgbot.Bot, ctx *ext.Context, rejection usernames.Rejection) error {
+	_, err := ctx.EffectiveMessage.Reply(b, r.slugRejectionText(rejection), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send reply message: %w", err)
+	}
+	return nil
+}
+
+// slugRejectionText explains why a slug is not accepted
+func (r *RequestContext) slugRejectionText(rejection usernames.Rejection) string {
+	var text string
+	switch rejection {
+	case usernames.Reserved, usernames.Banned:
+		text = r.locale.T(i18n.SlugNotAllowedText)
+	case usernames.Taken:
+		text = r.locale.T(i18n.SlugExistsText)
+	default:
+		text = r.locale.T(i18n.InvalidSlugText)
+	}
+	return text
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
+	"time"
+)
+
+var timezoneStep = flowStep[noPayload]{
+	state:   users.SettingTimezone,
+	ttl:     15 * time.Minute,
+	expired: i18n.StateExpiredText,
+	prompt: func(r *RequestContext, _ noPayload) string {
+		return r.locale.T(i18n.TimezoneExplanationText)
+	},
+	validate: func(r *RequestContext, msg *gotgbot.Message, _ noPayload) string {
+		if _, err := i18n.LoadTimezone(msg.Text); err != nil {
+			return r.locale.T(i18n.InvalidTimezoneText)
+		}
+		return ""
+	},
+	handle: (*RequestContext).setTimezone,
+}
+
+func (r *RequestContext) timezoneCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
+	cb := ctx.Update.CallbackQuery
+
+	// Remove timezone command buttons
+	_, _, err := cb.Message.EditReplyMarkup(b, &gotgbot.EditMessageReplyMarkupOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to update timezone message markup: %w", err)
+	}
+
+	if action == "CANCEL" {
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.NeverMindButtonText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "SET" {
+		err := timezoneStep.start(r, b, ctx.EffectiveChat.Id, noPayload{})
+		if err != nil {
+			return err
+		}
+
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.SettingTimezoneText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	} else if action == "REMOVE" {
+		err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
+			"Timezone": "",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to remove timezone: %w", err)
+		}
+
+		_, _, err = cb.Message.EditText(b, r.locale.T(i18n.TimezoneHasBeenRemovedText), &gotgbot.EditMessageTextOpts{})
+		if err != nil {
+			return fmt.Errorf("failed to update timezone message text: %w", err)
+		}
+
+		// Send callback answer to telegram
+		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+			Text: r.locale.T(i18n.TimezoneHasBeenRemovedText),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to answer callback: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *RequestContext) setTimezone(b *gotgbot.Bot, ctx *ext.Context, _ noPayload) error {
+	location, err := i18n.LoadTimezone(ctx.EffectiveMessage.Text)
+	if err != nil {
+		return err
+	}
+
+	err = r.userRepo.UpdateUser(r.user, map[string]interface{}{
+		"Timezone": location.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update user timezone: %w", err)
+	}
+	err = r.userRepo.ResetUserState(r.user)
+	if err != nil {
+		return err
+	}
+
+	text := r.locale.In(location).T(i18n.TimezoneHasBeenSetText, i18n.Args{
+		"timezone": location.String(),
+		"time":     r.locale.In(location).DateTime(time.Now()),
+	})
+	_, err = ctx.EffectiveMessage.Reply(b, text, nil)
+	if err != nil {
+		return fmt.Errorf("failed to send reply message: %w", err)
+	}
+
+	return nil
+}
@@ -1,66 +1,39 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/i18n"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/usernames"
 	"github.com/bugfloyd/anonymous-telegram-bot/common/users"
-	"regexp"
-	"strings"
+	"time"
 )
 
-func (r *RootHandler) manageUsername(b *gotgbot.Bot, ctx *ext.Context) error {
-	var text string
-	var buttons [][]gotgbot.InlineKeyboardButton
-
-	if r.user.Username != "" {
-		text = fmt.Sprintf(i18n.T(i18n.YourCurrentUsernameText), r.user.Username)
-		buttons = [][]gotgbot.InlineKeyboardButton{
-			{
-				{
-					Text:         i18n.T(i18n.ChangeUsernameButtonText),
-					CallbackData: "u",
-				},
-				{
-					Text:         i18n.T(i18n.RemoveUsernameButtonText),
-					CallbackData: "ru",
-				},
-				{
-					Text:         i18n.T(i18n.CancelButtonText),
-					CallbackData: "cu",
-				},
-			},
-		}
-	} else {
-		text = i18n.T(i18n.YouDontHaveAUsernameText)
-		buttons = [][]gotgbot.InlineKeyboardButton{
-			{
-				{
-					Text:         i18n.T(i18n.SetUsernameButtonText),
-					CallbackData: "u",
-				},
-				{
-					Text:         i18n.T(i18n.CancelButtonText),
-					CallbackData: "cu",
-				},
-			},
+var usernamePolicy = usernames.NewPolicy()
+
+// noPayload is the payload of the flow steps which don't keep anything along their state
+type noPayload struct{}
+
+var usernameStep = flowStep[noPayload]{
+	state:   users.SettingUsername,
+	ttl:     15 * time.Minute,
+	expired: i18n.StateExpiredText,
+	prompt: func(r *RequestContext, _ noPayload) string {
+		return fmt.Sprintf("%s\n\n%s", r.locale.T(i18n.UsernameExplanationText), r.locale.T(i18n.EnterANewUsernameText))
+	},
+	validate: func(r *RequestContext, msg *gotgbot.Message, _ noPayload) string {
+		rejection := usernamePolicy.Check(usernames.Normalize(msg.Text))
+		if rejection != usernames.Accepted {
+			return r.usernameRejectionText(rejection)
 		}
-	}
-
-	_, err := b.SendMessage(ctx.EffectiveChat.Id, text, &gotgbot.SendMessageOpts{
-		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
-			InlineKeyboard: buttons,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to send username info: %w", err)
-	}
-
-	return nil
+		return ""
+	},
+	handle: (*RequestContext).setUsername,
 }
 
-func (r *RootHandler) usernameCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
+func (r *RequestContext) usernameCallback(b *gotgbot.Bot, ctx *ext.Context, action string) error {
 	cb := ctx.Update.CallbackQuery
 
 	// Remove username command buttons
@@ -72,53 +45,50 @@ func (r *RootHandler) usernameCallback(b *gotgbot.Bot, ctx *ext.Context, action
 	if action == "CANCEL" {
 		// Send callback answer to telegram
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-			Text: i18n.T(i18n.NeverMindButtonText),
+			Text: r.locale.T(i18n.NeverMindButtonText),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to answer callback: %w", err)
 		}
 	} else if action == "SET" {
-		err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
-			"State":          users.SettingUsername,
-			"ContactUUID":    "",
-			"ReplyMessageID": 0,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to update user state: %w", err)
+		nextChange := usernamePolicy.NextChange(r.user.UsernameChangedAt)
+		if time.Now().Before(nextChange) {
+			_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+				Text:      r.locale.T(i18n.UsernameChangeTooSoonText, i18n.Args{"duration": r.locale.Duration(time.Until(nextChange))}),
+				ShowAlert: true,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to answer callback: %w", err)
+			}
+			return nil
 		}
 
-		// Send reply instruction
-		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf("%s\n\n%s", i18n.T(i18n.UsernameExplanationText), i18n.T(i18n.EnterANewUsernameText)), nil)
+		err := usernameStep.start(r, b, ctx.EffectiveChat.Id, noPayload{})
 		if err != nil {
-			return fmt.Errorf("failed to send reply message: %w", err)
+			return err
 		}
 
 		// Send callback answer to telegram
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-			Text: i18n.T(i18n.SettingUsernameText),
+			Text: r.locale.T(i18n.SettingUsernameText),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to answer callback: %w", err)
 		}
 	} else if action == "REMOVE" {
-		err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
-			"State":          users.Idle,
-			"Username":       "",
-			"ContactUUID":    "",
-			"ReplyMessageID": 0,
-		})
+		err := r.userRepo.ReleaseUsername(r.user)
 		if err != nil {
 			return fmt.Errorf("failed to remove username: %w", err)
 		}
 
-		_, _, err = cb.Message.EditText(b, i18n.T(i18n.UsernameHasBeenRemovedText), &gotgbot.EditMessageTextOpts{})
+		_, _, err = cb.Message.EditText(b, r.locale.T(i18n.UsernameHasBeenRemovedText), &gotgbot.EditMessageTextOpts{})
 		if err != nil {
 			return fmt.Errorf("failed to update username message text: %w", err)
 		}
 
 		// Send callback answer to telegram
 		_, err = cb.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
-			Text: i18n.T(i18n.UsernameHasBeenRemovedText),
+			Text: r.locale.T(i18n.UsernameHasBeenRemovedText),
 		})
 		if err != nil {
 			return fmt.Errorf("failed to answer callback: %w", err)
@@ -128,80 +98,85 @@ func (r *RootHandler) usernameCallback(b *gotgbot.Bot, ctx *ext.Context, action
 	return nil
 }
 
-func (r *RootHandler) setUsername(b *gotgbot.Bot, ctx *ext.Context) error {
-	username := ctx.EffectiveMessage.Text
+func (r *RequestContext) setUsername(b *gotgbot.Bot, ctx *ext.Context, _ noPayload) error {
+	username := usernames.Normalize(ctx.EffectiveMessage.Text)
+
+	if username == r.user.Username {
+		// Reset sender user
+		err := r.userRepo.ResetUserState(r.user)
+		if err != nil {
+			return err
+		}
 
-	if isValidUsername(username) == false {
-		// Send username instruction
-		_, err := ctx.EffectiveMessage.Reply(b, i18n.T(i18n.InvalidUsernameText), nil)
+		_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.SameUsernameText), nil)
 		if err != nil {
 			return fmt.Errorf("failed to send reply message: %w", err)
 		}
 		return nil
 	}
 
-	// Convert to lowercase
-	username = strings.ToLower(username)
-
-	existingUser, err := r.userRepo.ReadUserByUsername(username)
-	if err != nil || existingUser == nil {
-		err := r.userRepo.UpdateUser(r.user, map[string]interface{}{
-			"Username":       username,
-			"State":          users.Idle,
-			"ContactUUID":    "",
-			"ReplyMessageID": 0,
-		})
+	nextChange := usernamePolicy.NextChange(r.user.UsernameChangedAt)
+	if time.Now().Before(nextChange) {
+		err := r.userRepo.ResetUserState(r.user)
 		if err != nil {
-			return fmt.Errorf("failed to update username: %w", err)
+			return err
 		}
+		return r.rejectUsername(b, ctx, usernames.TooSoon)
+	}
 
-		// Send username instruction
-		_, err = ctx.EffectiveMessage.Reply(b, fmt.Sprintf(i18n.T(i18n.UsernameHasBeenSetText), username), nil)
-		if err != nil {
-			return fmt.Errorf("failed to send reply message: %w", err)
-		}
-	} else {
-		var text string
-		if existingUser.UUID != r.user.UUID {
-			text = i18n.T(i18n.UsernameExistsText)
-		} else {
-			text = i18n.T(i18n.SameUsernameText)
-
-			// Reset sender user
-			err = r.userRepo.ResetUserState(r.user)
-			if err != nil {
-				return err
-			}
-		}
-		// Send username instruction
-		_, err = ctx.EffectiveMessage.Reply(b, text, nil)
-		if err != nil {
-			return fmt.Errorf("failed to send reply message: %w", err)
-		}
+	err := r.userRepo.ClaimUsername(r.user, username, usernamePolicy.Quarantine)
+	if errors.Is(err, users.ErrUsernameTaken) {
+		return r.rejectUsername(b, ctx, usernames.Taken)
+	} else if errors.Is(err, users.ErrUsernameQuarantined) {
+		return r.rejectUsername(b, ctx, usernames.Quarantined)
+	} else if errors.Is(err, users.ErrUsernameLookAlike) {
+		return r.rejectUsername(b, ctx, usernames.LookAlike)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update username: %w", err)
+	}
+
+	// Send username instruction
+	_, err = ctx.EffectiveMessage.Reply(b, r.locale.T(i18n.UsernameHasBeenSetText, i18n.Args{"username": r.locale.Isolate(username)}), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send reply message: %w", err)
 	}
 
 	return nil
 }
 
-func isValidUsername(username string) bool {
-	// Check length
-	if len(username) < 3 || len(username) > 20 {
-		return false
-	}
-
-	// Regular expression to check valid characters
-	// ^[a-zA-Z0-9_]+$
-	// This checks the string consists only of English letters, digits, and underscores
-	re := regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
-	if !re.MatchString(username) {
-		return false
+// rejectUsername explains why the entered username was not accepted. Callers
+// leave the user in the setting username state to enter another one, unless
+// no username can be set yet.
+func (r *RequestContext) rejectUsername(b *gotgbot.Bot, ctx *ext.Context, rejection usernames.Rejection) error {
+	_, err := ctx.EffectiveMessage.Reply(b, r.usernameRejectionText(rejection), nil)
+	if err != nil {
+		return fmt.Errorf("failed to send reply message: %w", err)
 	}
+	return nil
+}
 
-	// Check first character (not a digit or underscore)
-	firstChar := username[0]
-	if firstChar == '_' || ('0' <= firstChar && firstChar <= '9') {
-		return false
+// usernameRejectionText explains why a username is not accepted
+func (r *RequestContext) usernameRejectionText(rejection usernames.Rejection) string {
+	var text string
+	switch rejection {
+	case usernames.MixedScript:
+		text = r.locale.T(i18n.MixedScriptUsernameText)
+	case usernames.Reserved:
+		text = r.locale.T(i18n.ReservedUsernameText)
+	case usernames.Banned:
+		text = r.locale.T(i18n.BannedUsernameText)
+	case usernames.LookAlike:
+		text = r.locale.T(i18n.LookAlikeUsernameText)
+	case usernames.Quarantined:
+		text = r.locale.T(i18n.QuarantinedUsernameText)
+	case usernames.Taken:
+		text = r.locale.T(i18n.UsernameExistsText)
+	case usernames.TooSoon:
+		nextChange := usernamePolicy.NextChange(r.user.UsernameChangedAt)
+		text = r.locale.T(i18n.UsernameChangeTooSoonText, i18n.Args{"duration": r.locale.Duration(time.Until(nextChange))})
+	default:
+		text = r.locale.T(i18n.InvalidUsernameText)
 	}
-
-	return true
+	return text
 }
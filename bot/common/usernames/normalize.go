@@ -0,0 +1,131 @@
+package usernames
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxLinkPayloadLength is the maximum length of a Telegram deep link start parameter
+const maxLinkPayloadLength = 64
+
+// zeroWidthRemover drops the invisible characters which make equal looking usernames differ
+var zeroWidthRemover = strings.NewReplacer(
+	"\u200b", "", // zero width space
+	"\u200c", "", // zero width non-joiner
+	"\u200d", "", // zero width joiner
+	"\u200e", "", // left-to-right mark
+	"\u200f", "", // right-to-left mark
+	"\u2060", "", // word joiner
+	"\ufeff", "", // zero width no-break space
+	"\u061c", "", // arabic letter mark
+	"\u0640", "", // arabic tatweel
+)
+
+// arabicPersianUnifier maps the Arabic forms of letters to the Persian ones and
+// both Arabic and Persian digits to ASCII digits
+var arabicPersianUnifier = strings.NewReplacer(
+	"\u064a", "\u06cc", // arabic yeh => farsi yeh
+	"\u0649", "\u06cc", // alef maksura => farsi yeh
+	"\u0643", "\u06a9", // arabic kaf => keheh
+	"٠", "0", "١", "1", "٢", "2", "٣", "3", "٤", "4",
+	"٥", "5", "٦", "6", "٧", "7", "٨", "8", "٩", "9",
+	"۰", "0", "۱", "1", "۲", "2", "۳", "3", "۴", "4",
+	"۵", "5", "۶", "6", "۷", "7", "۸", "8", "۹", "9",
+)
+
+// Normalize brings a username into the form in which it is stored and compared
+func Normalize(username string) string {
+	username = zeroWidthRemover.Replace(username)
+	username = norm.NFKC.String(username)
+	username = arabicPersianUnifier.Replace(username)
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// scripts are the writing systems a username may use, a username must not mix them
+var scripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{"Latin", []*unicode.RangeTable{unicode.Latin}},
+	{"Arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"Cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"Greek", []*unicode.RangeTable{unicode.Greek}},
+	{"Armenian", []*unicode.RangeTable{unicode.Armenian}},
+	{"Georgian", []*unicode.RangeTable{unicode.Georgian}},
+	{"Hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	{"Devanagari", []*unicode.RangeTable{unicode.Devanagari}},
+	{"Thai", []*unicode.RangeTable{unicode.Thai}},
+	{"Hangul", []*unicode.RangeTable{unicode.Hangul}},
+	{"CJK", []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana}},
+}
+
+// script returns the name of the writing system of the letter or an empty string if it is not supported
+func script(r rune) string {
+	for _, s := range scripts {
+		if unicode.In(r, s.tables...) {
+			return s.name
+		}
+	}
+	return ""
+}
+
+// checkCharacters validates the characters of a normalized username
+func checkCharacters(username string) Rejection {
+	runes := []rune(username)
+	if len(runes) < 3 || len(runes) > 20 || len(LinkPayload(username)) > maxLinkPayloadLength {
+		return Invalid
+	}
+	if !unicode.IsLetter(runes[0]) {
+		return Invalid
+	}
+
+	var usedScript string
+	for _, r := range runes {
+		switch {
+		case r == '_' || unicode.IsDigit(r):
+			continue
+		case !unicode.IsLetter(r):
+			return Invalid
+		}
+
+		s := script(r)
+		if s == "" {
+			return Invalid
+		}
+		if usedScript != "" && usedScript != s {
+			return MixedScript
+		}
+		usedScript = s
+	}
+
+	return Accepted
+}
+
+// LinkPayload returns the deep link start parameter of a username. Telegram
+// only accepts A-Z, a-z, 0-9, _ and - so other usernames are base64 encoded.
+func LinkPayload(username string) string {
+	for _, r := range username {
+		if r > unicode.MaxASCII {
+			return "-" + base64.RawURLEncoding.EncodeToString([]byte(username))
+		}
+	}
+	return "_" + username
+}
+
+// ParseLinkPayload returns the username of a deep link start parameter
+func ParseLinkPayload(payload string) (string, bool) {
+	switch {
+	case strings.HasPrefix(payload, "_"):
+		return Normalize(payload[1:]), true
+	case strings.HasPrefix(payload, "-"):
+		username, err := base64.RawURLEncoding.DecodeString(payload[1:])
+		if err != nil {
+			return "", false
+		}
+		return Normalize(string(username)), true
+	}
+	return "", false
+}
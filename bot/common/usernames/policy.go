@@ -0,0 +1,161 @@
+package usernames
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Rejection is the reason a username is not accepted by the policy
+type Rejection string
+
+const (
+	Accepted    Rejection = ""
+	Invalid     Rejection = "INVALID"
+	MixedScript Rejection = "MIXED_SCRIPT"
+	Reserved    Rejection = "RESERVED"
+	Banned      Rejection = "BANNED"
+	LookAlike   Rejection = "LOOK_ALIKE"
+	TooSoon     Rejection = "TOO_SOON"
+	Quarantined Rejection = "QUARANTINED"
+	Taken       Rejection = "TAKEN"
+)
+
+var defaultReservedWords = []string{
+	"admin", "administrator", "anonymous", "bot", "bugfloyd", "help", "info", "mod", "moderator",
+	"official", "owner", "root", "security", "staff", "support", "system", "telegram",
+}
+
+var defaultBannedWords = []string{
+	"fuck", "shit", "bitch", "cunt", "nazi", "hitler",
+}
+
+// Policy holds the rules a username has to follow
+type Policy struct {
+	// ReservedWords can not be used as a username or as one of its underscore separated parts
+	ReservedWords []string
+	// BannedWords can not be used as a username or as one of its underscore separated parts
+	BannedWords []string
+	// ChangeInterval is the minimum time between two username changes
+	ChangeInterval time.Duration
+	// Quarantine is the time a released username stays unavailable to other users
+	Quarantine time.Duration
+}
+
+// NewPolicy creates the policy from the defaults extended by the
+// USERNAME_RESERVED_WORDS and USERNAME_BANNED_WORDS comma separated lists and
+// the USERNAME_CHANGE_INTERVAL and USERNAME_QUARANTINE durations.
+func NewPolicy() Policy {
+	return Policy{
+		ReservedWords:  append(defaultReservedWords, splitList(os.Getenv("USERNAME_RESERVED_WORDS"))...),
+		BannedWords:    append(defaultBannedWords, splitList(os.Getenv("USERNAME_BANNED_WORDS"))...),
+		ChangeInterval: ParseDuration(os.Getenv("USERNAME_CHANGE_INTERVAL"), 24*time.Hour),
+		Quarantine:     ParseDuration(os.Getenv("USERNAME_QUARANTINE"), 30*24*time.Hour),
+	}
+}
+
+// Check validates a normalized username itself, the checks against other
+// users' usernames happen while claiming it
+func (p Policy) Check(username string) Rejection {
+	if rejection := checkCharacters(username); rejection != Accepted {
+		return rejection
+	}
+	return p.checkWords(username)
+}
+
+var validSlug = regexp.MustCompile(`^[a-z][a-z0-9_-]{3,31}$`)
+
+// CheckSlug validates a normalized vanity link slug. Slugs are part of the
+// link itself so unlike usernames they are limited to the characters
+// Telegram accepts in a deep link and can not start with the username
+// link prefixes.
+func (p Policy) CheckSlug(slug string) Rejection {
+	if !validSlug.MatchString(slug) {
+		return Invalid
+	}
+	return p.checkWords(slug)
+}
+
+// checkWords looks for the reserved and banned words in a username or slug.
+// Words are matched against the whole name and its underscore or dash
+// separated parts, never inside a part, so innocent names containing one
+// aren't rejected.
+func (p Policy) checkWords(name string) Rejection {
+	skeletons := []string{Skeleton(name)}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-'
+	}) {
+		skeletons = append(skeletons, Skeleton(part))
+	}
+
+	for _, word := range p.ReservedWords {
+		if slices.Contains(skeletons, Skeleton(word)) {
+			return Reserved
+		}
+	}
+	for _, word := range p.BannedWords {
+		if slices.Contains(skeletons, Skeleton(word)) {
+			return Banned
+		}
+	}
+
+	return Accepted
+}
+
+// NextChange returns when a user who last changed the username at the given
+// time may change it again
+func (p Policy) NextChange(lastChange time.Time) time.Time {
+	if lastChange.IsZero() {
+		return time.Time{}
+	}
+	return lastChange.Add(p.ChangeInterval)
+}
+
+// skeletonReplacer maps look-alike characters, including the Cyrillic and
+// Greek letters which look like Latin ones, to a single character
+var skeletonReplacer = strings.NewReplacer(
+	"_", "",
+	"-", "",
+	"а", "a", "в", "b", "е", "e", "к", "k", "м", "m", "н", "h", "о", "o", "р", "p",
+	"с", "c", "т", "t", "у", "y", "х", "x", "і", "l", "ј", "j", "ѕ", "s",
+	"α", "a", "β", "b", "ε", "e", "ι", "l", "κ", "k", "ν", "v", "ο", "o", "ρ", "p", "τ", "t", "υ", "u",
+	"rn", "m",
+	"vv", "w",
+	"0", "o",
+	"1", "l",
+	"i", "l",
+	"3", "e",
+	"4", "a",
+	"5", "s",
+	"7", "t",
+	"8", "b",
+	"9", "g",
+)
+
+// Skeleton reduces a username to a form in which look-alike usernames are equal
+func Skeleton(username string) string {
+	return skeletonReplacer.Replace(Normalize(username))
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseDuration reads a duration setting like 24h, an empty or invalid value
+// gives the fallback
+func ParseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,153 @@
+package usernames
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	policy := Policy{
+		ReservedWords: []string{"admin", "support"},
+		BannedWords:   []string{"shit"},
+	}
+
+	tests := []struct {
+		username string
+		want     Rejection
+	}{
+		{"john_doe", Accepted},
+		{"modest", Accepted},
+		{"ab", Invalid},
+		{"_john", Invalid},
+		{"1john", Invalid},
+		{"john-doe", Invalid},
+		{"admin", Reserved},
+		{"Adm1n", Reserved},
+		{"support_team", Reserved},
+		{"sh1t", Banned},
+		{"sh1t_happens", Banned},
+		{"mishits", Accepted},
+	}
+
+	for _, test := range tests {
+		if got := policy.Check(test.username); got != test.want {
+			t.Errorf("Check(%q) = %q, want %q", test.username, got, test.want)
+		}
+	}
+}
+
+func TestCheckSlug(t *testing.T) {
+	policy := Policy{
+		ReservedWords: []string{"admin"},
+		BannedWords:   []string{"shit"},
+	}
+
+	tests := []struct {
+		slug string
+		want Rejection
+	}{
+		{"my-inbox", Accepted},
+		{"john_doe_2024", Accepted},
+		{"abc", Invalid},
+		{"_john", Invalid},
+		{"-john", Invalid},
+		{"علی_رضا", Invalid},
+		{"admin-inbox", Reserved},
+		{"no-shit", Banned},
+	}
+
+	for _, test := range tests {
+		if got := policy.CheckSlug(test.slug); got != test.want {
+			t.Errorf("CheckSlug(%q) = %q, want %q", test.slug, got, test.want)
+		}
+	}
+}
+
+func TestSkeleton(t *testing.T) {
+	pairs := [][2]string{
+		{"admin", "adm1n"},
+		{"modern", "modem"},
+		{"john_doe", "j0hndoe"},
+		{"willow", "vvi11ow"},
+	}
+
+	for _, pair := range pairs {
+		if Skeleton(pair[0]) != Skeleton(pair[1]) {
+			t.Errorf("expected %q and %q to look alike", pair[0], pair[1])
+		}
+	}
+}
+
+func TestNextChange(t *testing.T) {
+	policy := Policy{ChangeInterval: time.Hour}
+
+	if !policy.NextChange(time.Time{}).IsZero() {
+		t.Errorf("expected no waiting time for users who never changed their username")
+	}
+
+	last := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if next := policy.NextChange(last); !next.Equal(last.Add(time.Hour)) {
+		t.Errorf("NextChange() = %s, want %s", next, last.Add(time.Hour))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"John_Doe", "john_doe"},
+		{"Ｊｏｈｎ", "john"},
+		{"علي", "علی"},
+		{"كاوه", "کاوه"},
+		{"سارا\u200cجان", "ساراجان"},
+		{"م\u0640\u0640هدی", "مهدی"},
+		{"رضا۱۳", "رضا13"},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.username); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.username, got, test.want)
+		}
+	}
+}
+
+func TestCheckScripts(t *testing.T) {
+	policy := Policy{}
+
+	tests := []struct {
+		username string
+		want     Rejection
+	}{
+		{"علی_رضا", Accepted},
+		{"мария", Accepted},
+		{"adminа", MixedScript},
+		{"علیali", MixedScript},
+		{"۱علی", Invalid},
+		{"john😀", Invalid},
+	}
+
+	for _, test := range tests {
+		if got := policy.Check(Normalize(test.username)); got != test.want {
+			t.Errorf("Check(%q) = %q, want %q", test.username, got, test.want)
+		}
+	}
+}
+
+func TestLinkPayload(t *testing.T) {
+	for _, username := range []string{"john_doe", "علی_رضا", "мария"} {
+		payload := LinkPayload(username)
+		if len(payload) > maxLinkPayloadLength {
+			t.Errorf("payload of %q is too long: %q", username, payload)
+		}
+		for _, r := range payload {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				t.Errorf("payload of %q contains an invalid character: %q", username, payload)
+				break
+			}
+		}
+		if got, ok := ParseLinkPayload(payload); !ok || got != username {
+			t.Errorf("ParseLinkPayload(%q) = %q, %t, want %q", payload, got, ok, username)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package users
+
+import "time"
+
+// Block keeps the metadata of a single blocker/blocked pair
+type Block struct {
+	BlockerUUID string `dynamo:",hash"`
+	BlockedUUID string `dynamo:",range" index:"BlockedUUID-GSI,hash"`
+	Label       int32
+	Mode        BlockMode `dynamo:",omitempty"`
+	Reason      BlockReason
+	Snippet     string    `dynamo:",omitempty"`
+	CreatedAt   time.Time `dynamo:",unixtime"`
+	ExpiresAt   time.Time `dynamo:",unixtime,omitempty"`
+}
+
+type BlockMode string
+
+const (
+	// Blocked refuses all messages, blocks created before modes existed have an empty mode
+	Blocked BlockMode = "BLOCK"
+	// Muted accepts messages but delivers them without notifications
+	Muted BlockMode = "MUTE"
+)
+
+type BlockReason string
+
+const (
+	BlockedByUser         BlockReason = "USER"
+	MigratedFromBlacklist BlockReason = "MIGRATED"
+)
+
+// IsMuted reports whether the block only silences the notifications
+func (b *Block) IsMuted() bool {
+	return b.Mode == Muted
+}
+
+// IsExpired reports whether a temporary block has ended
+func (b *Block) IsExpired() bool {
+	return !b.ExpiresAt.IsZero() && time.Now().After(b.ExpiresAt)
+}
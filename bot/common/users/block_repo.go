@@ -0,0 +1,268 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/guregu/dynamo"
+)
+
+const maxSnippetLength = 40
+
+type BlockRepository struct {
+	table dynamo.Table
+	users dynamo.Table
+}
+
+func NewBlockRepository(db *dynamo.DB) (*BlockRepository, error) {
+	return &BlockRepository{
+		table: db.Table("AnonymousBotBlocks"),
+		users: db.Table("AnonymousBot"),
+	}, nil
+}
+
+// CreateBlock blocks or mutes the given user. A zero duration never expires.
+func (repo *BlockRepository) CreateBlock(blocker *User, blockedUUID string, mode BlockMode, duration time.Duration, reason BlockReason, snippet string) (*Block, error) {
+	b := Block{
+		BlockerUUID: blocker.UUID,
+		BlockedUUID: blockedUUID,
+		Mode:        mode,
+		Reason:      reason,
+		Snippet:     truncate(snippet, maxSnippetLength),
+		CreatedAt:   time.Now(),
+	}
+	if duration > 0 {
+		b.ExpiresAt = b.CreatedAt.Add(duration)
+	}
+
+	existing, err := repo.ReadBlock(blocker.UUID, blockedUUID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		// Keep the label so the conversation stays recognizable
+		b.Label = existing.Label
+		if b.Snippet == "" {
+			b.Snippet = existing.Snippet
+		}
+	} else {
+		b.Label, err = repo.nextLabels(blocker, 1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = repo.table.Put(b).Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create block: %w", err)
+	}
+	return &b, nil
+}
+
+// ReadBlock returns the block between the given users or nil if there is none
+// or it has expired
+func (repo *BlockRepository) ReadBlock(blockerUUID string, blockedUUID string) (*Block, error) {
+	var b Block
+	err := repo.table.Get("BlockerUUID", blockerUUID).Range("BlockedUUID", dynamo.Equal, blockedUUID).One(&b)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block: %w", err)
+	}
+	if b.IsExpired() {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+// ReadBlocks returns all the blocks of the given user, newest first
+func (repo *BlockRepository) ReadBlocks(blocker *User) ([]Block, error) {
+	var records []Block
+	err := repo.table.Get("BlockerUUID", blocker.UUID).All(&records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocks: %w", err)
+	}
+
+	// Expired blocks stay in the table until DynamoDB TTL removes them
+	blocks := make([]Block, 0, len(records))
+	for _, b := range records {
+		if !b.IsExpired() {
+			blocks = append(blocks, b)
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].CreatedAt.After(blocks[j].CreatedAt)
+	})
+	return blocks, nil
+}
+
+func (repo *BlockRepository) DeleteBlock(blocker *User, blockedUUID string) error {
+	err := repo.table.Delete("BlockerUUID", blocker.UUID).Range("BlockedUUID", blockedUUID).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete block: %w", err)
+	}
+	return nil
+}
+
+func (repo *BlockRepository) DeleteAllBlocks(blocker *User) error {
+	var blocks []Block
+	err := repo.table.Get("BlockerUUID", blocker.UUID).All(&blocks)
+	if err != nil {
+		return fmt.Errorf("failed to get blocks: %w", err)
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(blocks))
+	for _, b := range blocks {
+		keys = append(keys, dynamo.Keys{b.BlockerUUID, b.BlockedUUID})
+	}
+	_, err = repo.table.Batch("BlockerUUID", "BlockedUUID").Write().Delete(keys...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete blocks: %w", err)
+	}
+	return nil
+}
+
+// DeleteBlocksAgainst removes the user from the blocks of all other users
+func (repo *BlockRepository) DeleteBlocksAgainst(blocked *User) error {
+	var blocks []Block
+	err := repo.table.Get("BlockedUUID", blocked.UUID).Index("BlockedUUID-GSI").All(&blocks)
+	if err != nil {
+		return fmt.Errorf("failed to get blocks: %w", err)
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(blocks))
+	for _, b := range blocks {
+		keys = append(keys, dynamo.Keys{b.BlockerUUID, b.BlockedUUID})
+	}
+	_, err = repo.table.Batch("BlockerUUID", "BlockedUUID").Write().Delete(keys...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete blocks: %w", err)
+	}
+	return nil
+}
+
+// MigrateBlacklist moves the legacy blacklist string set of the user into
+// block records and removes the set from the user item. Users in the set who
+// deleted their account since are left out.
+func (repo *BlockRepository) MigrateBlacklist(userRepo *UserRepository, user *User) error {
+	if len(user.Blacklist) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var items []Block
+	for _, blockedUUID := range user.Blacklist {
+		existing, err := repo.ReadBlock(user.UUID, blockedUUID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		_, err = userRepo.ReadUserByUUID(blockedUUID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		items = append(items, Block{
+			BlockerUUID: user.UUID,
+			BlockedUUID: blockedUUID,
+			Mode:        Blocked,
+			Reason:      MigratedFromBlacklist,
+			CreatedAt:   now,
+		})
+	}
+
+	if len(items) > 0 {
+		first, err := repo.nextLabels(user, int32(len(items)))
+		if err != nil {
+			return err
+		}
+		puts := make([]interface{}, 0, len(items))
+		for i, b := range items {
+			b.Label = first + int32(i)
+			puts = append(puts, b)
+		}
+		_, err = repo.table.Batch("BlockerUUID", "BlockedUUID").Write().Put(puts...).Run()
+		if err != nil {
+			return fmt.Errorf("failed to migrate blacklist: %w", err)
+		}
+	}
+	return userRepo.ClearBlacklist(user)
+}
+
+// nextLabels hands out n new labels for the blocks of the user and returns
+// the first of them. The counter on the user item is incremented atomically
+// so concurrent blocks never share a label, users who blocked someone before
+// the counter existed get it started from their highest label.
+func (repo *BlockRepository) nextLabels(blocker *User, n int32) (int32, error) {
+	for {
+		var counter struct{ BlockLabels int32 }
+		err := repo.users.Update("UUID", blocker.UUID).
+			Add("BlockLabels", n).
+			If("attribute_exists('BlockLabels')").
+			OnlyUpdatedValue(&counter)
+		if err == nil {
+			blocker.BlockLabels = counter.BlockLabels
+			return counter.BlockLabels - n + 1, nil
+		}
+		if !dynamo.IsCondCheckFailed(err) {
+			return 0, fmt.Errorf("failed to count block labels: %w", err)
+		}
+
+		label, err := repo.lastLabel(blocker.UUID)
+		if err != nil {
+			return 0, err
+		}
+		err = repo.users.Update("UUID", blocker.UUID).
+			Set("BlockLabels", label+n).
+			If("attribute_not_exists('BlockLabels')").
+			Run()
+		if dynamo.IsCondCheckFailed(err) {
+			// Another block started the counter meanwhile
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to start block labels: %w", err)
+		}
+		blocker.BlockLabels = label + n
+		return label + 1, nil
+	}
+}
+
+// lastLabel returns the highest label used among the user's blocks
+func (repo *BlockRepository) lastLabel(blockerUUID string) (int32, error) {
+	var blocks []Block
+	err := repo.table.Get("BlockerUUID", blockerUUID).Project("Label").All(&blocks)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get blocks: %w", err)
+	}
+
+	var label int32
+	for _, b := range blocks {
+		label = max(label, b.Label)
+	}
+	return label, nil
+}
+
+// Utility function to shorten a text to the given number of runes
+func truncate(text string, length int) string {
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:length]) + "…"
+}
@@ -0,0 +1,65 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JobKind names what a job does when it is due
+type JobKind string
+
+const (
+	// DeliverMessageJob delivers an anonymous message once its undo window is over
+	DeliverMessageJob JobKind = "DELIVER_MESSAGE"
+	// ScheduledMessageJob delivers an anonymous message at the time its sender picked
+	ScheduledMessageJob JobKind = "SCHEDULED_MESSAGE"
+)
+
+// pendingQueue is the partition of the due time index every pending job is in
+const pendingQueue = "PENDING"
+
+// Job is a piece of work to be done at its due time, the queue keeps it until
+// a runner completes it or its owner cancels it
+type Job struct {
+	UUID      string    `dynamo:",hash"`
+	Queue     string    `index:"Queue-DueAt-GSI,hash"`
+	DueAt     time.Time `dynamo:",unixtime" index:"Queue-DueAt-GSI,range"`
+	Kind      JobKind
+	OwnerUUID string `index:"OwnerUUID-GSI,hash"`
+	// Payload is the JSON encoded input of the job
+	Payload string
+	// Attempts counts the runners which claimed the job, a job claimed once can't be cancelled anymore
+	Attempts  int       `dynamo:",omitempty"`
+	CreatedAt time.Time `dynamo:",unixtime"`
+}
+
+// NewJob prepares a job of the owner due at the given time. Its UUID is known
+// before it is queued by CreateJob, so it can be referred to by its payload.
+func NewJob(owner *User, kind JobKind, dueAt time.Time) *Job {
+	return &Job{
+		UUID:      uuid.New().String(),
+		Queue:     pendingQueue,
+		DueAt:     dueAt,
+		Kind:      kind,
+		OwnerUUID: owner.UUID,
+		CreatedAt: time.Now(),
+	}
+}
+
+// SetPayload stores v as JSON in the payload of the job
+func (j *Job) SetPayload(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job payload: %w", err)
+	}
+	j.Payload = string(data)
+	return nil
+}
+
+// DecodePayload decodes the payload of the job into v
+func (j *Job) DecodePayload(v interface{}) error {
+	return json.Unmarshal([]byte(j.Payload), v)
+}
@@ -0,0 +1,144 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/guregu/dynamo"
+)
+
+// ErrJobGone is returned when a job was already claimed, completed or cancelled
+var ErrJobGone = errors.New("job is not pending anymore")
+
+type JobRepository struct {
+	table dynamo.Table
+}
+
+func NewJobRepository(db *dynamo.DB) (*JobRepository, error) {
+	return &JobRepository{
+		table: db.Table("AnonymousBotJobs"),
+	}, nil
+}
+
+func (repo *JobRepository) CreateJob(job *Job) error {
+	err := repo.table.Put(job).Run()
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+// ReadDueJobs returns the pending jobs due by the given time, earliest first
+func (repo *JobRepository) ReadDueJobs(now time.Time) ([]Job, error) {
+	var jobs []Job
+	err := repo.table.Get("Queue", pendingQueue).
+		Index("Queue-DueAt-GSI").
+		Range("DueAt", dynamo.LessOrEqual, now.Unix()).
+		Order(dynamo.Ascending).
+		All(&jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// ClaimJob leases the job to the runner so no other runner does it meanwhile.
+// The job comes due again once the lease is over, so a runner failing to
+// complete it doesn't lose it.
+func (repo *JobRepository) ClaimJob(job *Job, lease time.Duration) error {
+	leasedUntil := time.Now().Add(lease)
+	err := repo.table.Update("UUID", job.UUID).
+		Set("DueAt", leasedUntil.Unix()).
+		Add("Attempts", 1).
+		If("'DueAt' = ?", job.DueAt.Unix()).
+		Run()
+	if dynamo.IsCondCheckFailed(err) {
+		return ErrJobGone
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	job.DueAt = leasedUntil
+	job.Attempts++
+	return nil
+}
+
+// CompleteJob takes a job done or given up on off the queue
+// PostponeJob moves a claimed job which has to wait longer than its lease to
+// the given time, unless another runner took it over since
+func (repo *JobRepository) PostponeJob(job *Job, dueAt time.Time) error {
+	err := repo.table.Update("UUID", job.UUID).
+		Set("DueAt", dueAt.Unix()).
+		If("'DueAt' = ?", job.DueAt.Unix()).
+		Run()
+	if dynamo.IsCondCheckFailed(err) {
+		return ErrJobGone
+	}
+	if err != nil {
+		return fmt.Errorf("failed to postpone job: %w", err)
+	}
+
+	job.DueAt = dueAt
+	return nil
+}
+
+func (repo *JobRepository) CompleteJob(job *Job) error {
+	err := repo.table.Delete("UUID", job.UUID).Run()
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	return nil
+}
+
+// CancelJob takes a pending job of the owner off the queue before any runner claims it
+func (repo *JobRepository) CancelJob(owner *User, uuid string) error {
+	err := repo.table.Delete("UUID", uuid).If("'OwnerUUID' = ? AND attribute_not_exists('Attempts')", owner.UUID).Run()
+	if dynamo.IsCondCheckFailed(err) {
+		return ErrJobGone
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+	return nil
+}
+
+// ReadOwnerJobs returns the pending jobs of the kind the user owns, earliest first
+func (repo *JobRepository) ReadOwnerJobs(owner *User, kind JobKind) ([]Job, error) {
+	var jobs []Job
+	err := repo.table.Get("OwnerUUID", owner.UUID).
+		Index("OwnerUUID-GSI").
+		Filter("'Kind' = ?", kind).
+		All(&jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user jobs: %w", err)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].DueAt.Before(jobs[j].DueAt)
+	})
+	return jobs, nil
+}
+
+// DeleteOwnerJobs removes every pending job the user owns
+func (repo *JobRepository) DeleteOwnerJobs(owner *User) error {
+	var jobs []Job
+	err := repo.table.Get("OwnerUUID", owner.UUID).Index("OwnerUUID-GSI").All(&jobs)
+	if err != nil {
+		return fmt.Errorf("failed to get user jobs: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(jobs))
+	for _, job := range jobs {
+		keys = append(keys, dynamo.Keys{job.UUID})
+	}
+	_, err = repo.table.Batch("UUID").Write().Delete(keys...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete jobs: %w", err)
+	}
+	return nil
+}
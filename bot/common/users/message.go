@@ -0,0 +1,15 @@
+package users
+
+import "time"
+
+// Message keeps the metadata of an anonymous message, the content itself
+// stays in the sender's chat and is copied when the receiver opens it
+type Message struct {
+	UUID            string `dynamo:",hash"`
+	SenderUUID      string `index:"SenderUUID-GSI,hash"`
+	ReceiverUUID    string `index:"ReceiverUUID-GSI,hash"`
+	SenderMessageID int64
+	ReplyMessageID  int64     `dynamo:",omitempty"`
+	CreatedAt       time.Time `dynamo:",unixtime"`
+	OpenedAt        time.Time `dynamo:",unixtime,omitempty"`
+}
@@ -0,0 +1,103 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo"
+)
+
+type MessageRepository struct {
+	table dynamo.Table
+}
+
+func NewMessageRepository(db *dynamo.DB) (*MessageRepository, error) {
+	return &MessageRepository{
+		table: db.Table("AnonymousBotMessages"),
+	}, nil
+}
+
+func (repo *MessageRepository) CreateMessage(sender *User, receiver *User, senderMessageID int64, replyMessageID int64) (*Message, error) {
+	m := Message{
+		UUID:            uuid.New().String(),
+		SenderUUID:      sender.UUID,
+		ReceiverUUID:    receiver.UUID,
+		SenderMessageID: senderMessageID,
+		ReplyMessageID:  replyMessageID,
+		CreatedAt:       time.Now(),
+	}
+	err := repo.table.Put(m).Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message: %w", err)
+	}
+	return &m, nil
+}
+
+// ReadMessage returns the message with the given UUID or nil if it does not exist anymore
+func (repo *MessageRepository) ReadMessage(uuid string) (*Message, error) {
+	var m Message
+	err := repo.table.Get("UUID", uuid).One(&m)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &m, nil
+}
+
+// ReadUserMessages returns the messages sent and received by the user
+func (repo *MessageRepository) ReadUserMessages(user *User) ([]Message, error) {
+	var sent, received []Message
+	err := repo.table.Get("SenderUUID", user.UUID).Index("SenderUUID-GSI").All(&sent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sent messages: %w", err)
+	}
+	err = repo.table.Get("ReceiverUUID", user.UUID).Index("ReceiverUUID-GSI").All(&received)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get received messages: %w", err)
+	}
+	return append(sent, received...), nil
+}
+
+// DeleteMessage removes the message
+func (repo *MessageRepository) DeleteMessage(message *Message) error {
+	err := repo.table.Delete("UUID", message.UUID).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+func (repo *MessageRepository) MarkMessageOpened(message *Message) error {
+	now := time.Now()
+	err := repo.table.Update("UUID", message.UUID).Set("OpenedAt", now.Unix()).Run()
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+	message.OpenedAt = now
+	return nil
+}
+
+// DeleteUserMessages removes the messages sent and received by the user
+func (repo *MessageRepository) DeleteUserMessages(user *User) error {
+	messages, err := repo.ReadUserMessages(user)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(messages))
+	for _, m := range messages {
+		keys = append(keys, dynamo.Keys{m.UUID})
+	}
+	_, err = repo.table.Batch("UUID").Write().Delete(keys...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	return nil
+}
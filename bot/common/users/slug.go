@@ -0,0 +1,23 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSlugTaken is returned when another user owns the vanity link slug or it still redirects to its previous owner
+var ErrSlugTaken = errors.New("slug is already taken")
+
+// SlugClaim maps a vanity link slug to the inbox of its owner. A replaced or
+// removed slug is retired and keeps leading to its owner for the redirect window.
+type SlugClaim struct {
+	Slug      string    `dynamo:",hash"`
+	OwnerUUID string    `index:"OwnerUUID-GSI,hash"`
+	CreatedAt time.Time `dynamo:",unixtime"`
+	RetiredAt time.Time `dynamo:",unixtime,omitempty"`
+}
+
+// isActive reports whether the slug still leads to its owner
+func (c *SlugClaim) isActive(redirectWindow time.Duration) bool {
+	return c.RetiredAt.IsZero() || time.Since(c.RetiredAt) < redirectWindow
+}
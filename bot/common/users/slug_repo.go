@@ -0,0 +1,117 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/guregu/dynamo"
+)
+
+// ClaimSlug atomically reserves the vanity link slug for the user and retires
+// the previous slug of the user. Slugs retired by other users can be claimed
+// after the redirect window.
+func (repo *UserRepository) ClaimSlug(user *User, slug string, redirectWindow time.Duration) error {
+	now := time.Now()
+	tx := repo.db.WriteTx()
+	tx.Put(repo.slugs.Put(SlugClaim{
+		Slug:      slug,
+		OwnerUUID: user.UUID,
+		CreatedAt: now,
+	}).If("attribute_not_exists('Slug') OR 'OwnerUUID' = ? OR 'RetiredAt' < ?", user.UUID, now.Add(-redirectWindow).Unix()))
+	tx.Update(resetState(repo.table.Update("UUID", user.UUID).
+		Set("Slug", slug)))
+	if user.Slug != "" && user.Slug != slug {
+		tx.Update(repo.retireSlug(user, user.Slug, now))
+	}
+
+	err := tx.Run()
+	if dynamo.IsCondCheckFailed(err) {
+		return ErrSlugTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim slug: %w", err)
+	}
+
+	user.Slug = slug
+	user.clearState()
+	return nil
+}
+
+// ReleaseSlug removes the vanity link slug of the user, the slug keeps leading
+// to the user for the redirect window
+func (repo *UserRepository) ReleaseSlug(user *User) error {
+	tx := repo.db.WriteTx()
+	tx.Update(resetState(repo.table.Update("UUID", user.UUID).
+		Remove("Slug")))
+	if user.Slug != "" {
+		tx.Update(repo.retireSlug(user, user.Slug, time.Now()))
+	}
+
+	err := tx.Run()
+	if err != nil {
+		return fmt.Errorf("failed to release slug: %w", err)
+	}
+
+	user.Slug = ""
+	user.clearState()
+	return nil
+}
+
+// ReadUserBySlug returns the owner of an active or recently retired slug, or nil if the slug leads nowhere
+func (repo *UserRepository) ReadUserBySlug(slug string, redirectWindow time.Duration) (*User, error) {
+	var claim SlugClaim
+	err := repo.slugs.Get("Slug", slug).One(&claim)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slug: %w", err)
+	}
+	if !claim.isActive(redirectWindow) {
+		return nil, nil
+	}
+
+	user, err := repo.ReadUserByUUID(claim.OwnerUUID)
+	if errors.Is(err, dynamo.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// ReadUserSlugs returns the current and retired slugs of the user
+func (repo *UserRepository) ReadUserSlugs(user *User) ([]SlugClaim, error) {
+	var claims []SlugClaim
+	err := repo.slugs.Get("OwnerUUID", user.UUID).Index("OwnerUUID-GSI").All(&claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slugs: %w", err)
+	}
+	return claims, nil
+}
+
+// DeleteUserSlugs removes all the slugs of the user so none of them leads to the user anymore
+func (repo *UserRepository) DeleteUserSlugs(user *User) error {
+	claims, err := repo.ReadUserSlugs(user)
+	if err != nil {
+		return err
+	}
+	if len(claims) == 0 {
+		return nil
+	}
+
+	keys := make([]dynamo.Keyed, 0, len(claims))
+	for _, claim := range claims {
+		keys = append(keys, dynamo.Keys{claim.Slug})
+	}
+	_, err = repo.slugs.Batch("Slug").Write().Delete(keys...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to delete slugs: %w", err)
+	}
+	return nil
+}
+
+func (repo *UserRepository) retireSlug(user *User, slug string, retiredAt time.Time) *dynamo.Update {
+	return repo.slugs.Update("Slug", slug).
+		Set("RetiredAt", retiredAt.Unix()).
+		If("'OwnerUUID' = ?", user.UUID)
+}
@@ -0,0 +1,97 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guregu/dynamo"
+)
+
+// State is the name of the flow step the bot waits for a message of the user in
+type State string
+
+const (
+	Idle            State = "IDLE"
+	Sending         State = "SENDING"
+	SettingUsername State = "SETTING_USERNAME"
+	SettingSlug     State = "SETTING_SLUG"
+	SettingTimezone State = "SETTING_TIMEZONE"
+)
+
+// stateFields are the attributes keeping a state besides its name. States set
+// before payloads existed kept the contact of the sending state in
+// ContactUUID and ReplyMessageID.
+var stateFields = []string{"StateData", "StateExpiresAt", "ContactUUID", "ReplyMessageID"}
+
+// SetState moves the user into the state until it expires, the payload is stored as JSON along the state
+func (repo *UserRepository) SetState(user *User, state State, payload interface{}, expiresAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state payload: %w", err)
+	}
+
+	err = repo.table.Update("UUID", user.UUID).
+		Set("State", state).
+		Set("StateData", string(data)).
+		Set("StateExpiresAt", expiresAt.Unix()).
+		Remove("ContactUUID", "ReplyMessageID").
+		Run()
+	if err != nil {
+		return fmt.Errorf("failed to set user state: %w", err)
+	}
+
+	user.State = state
+	user.StateData = string(data)
+	user.StateExpiresAt = expiresAt
+	user.ContactUUID = ""
+	user.ReplyMessageID = 0
+	return nil
+}
+
+// ResetUserState returns the user to the idle state and drops the state payload
+func (repo *UserRepository) ResetUserState(user *User) error {
+	err := resetState(repo.table.Update("UUID", user.UUID)).Run()
+	if err != nil {
+		return fmt.Errorf("failed to reset user state: %w", err)
+	}
+	user.clearState()
+	return nil
+}
+
+// resetState adds returning the user to the idle state to an update of the user item
+func resetState(update *dynamo.Update) *dynamo.Update {
+	return update.Set("State", Idle).Remove(stateFields...)
+}
+
+func (u *User) clearState() {
+	u.State = Idle
+	u.StateData = ""
+	u.StateExpiresAt = time.Time{}
+	u.ContactUUID = ""
+	u.ReplyMessageID = 0
+}
+
+// StatePayload decodes the payload of the current state into v
+func (u *User) StatePayload(v interface{}) error {
+	data := []byte(u.StateData)
+	if u.StateData == "" {
+		// The legacy sending state fields map onto the payload fields of the same name
+		var err error
+		data, err = json.Marshal(struct {
+			ContactUUID    string
+			ReplyMessageID int64
+		}{u.ContactUUID, u.ReplyMessageID})
+		if err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// StateExpired reports whether the user has been in a state for longer than it
+// waits for them. States set before expiry times existed have none and count
+// as expired.
+func (u *User) StateExpired() bool {
+	return u.State != Idle && (u.StateExpiresAt.IsZero() || time.Now().After(u.StateExpiresAt))
+}
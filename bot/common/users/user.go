@@ -6,22 +6,44 @@ import (
 )
 
 type User struct {
-	UUID           string `dynamo:",hash"`
-	UserID         int64  `index:"UserID-GSI,hash"`
-	Username       string `index:"Username-GSI,hash"`
-	State          State
-	Blacklist      []string      `dynamo:",set,omitempty,omitemptyelem"`
-	ContactUUID    string        `dynamo:",omitempty"`
-	ReplyMessageID int64         `dynamo:",omitempty"`
-	Language       i18n.Language `dynamo:",omitempty"`
-	LinkKey        int32         `index:"LinkKey-GSI,hash"`
-	CreatedAt      time.Time     `dynamo:",unixtime" index:"LinkKey-GSI,range"`
-}
+	UUID              string    `dynamo:",hash"`
+	UserID            int64     `index:"UserID-GSI,hash"`
+	Username          string    `index:"Username-GSI,hash"`
+	UsernameChangedAt time.Time `dynamo:",unixtime,omitempty"`
+	Slug              string    `dynamo:",omitempty"`
+	State             State
+	StateData         string        `dynamo:",omitempty"`
+	StateExpiresAt    time.Time     `dynamo:",unixtime,omitempty"`
+	Language          i18n.Language `dynamo:",omitempty"`
+	Timezone          string        `dynamo:",omitempty"`
+	SilentMessages    bool          `dynamo:",omitempty"`
+	ConfirmSending    bool          `dynamo:",omitempty"`
+	SendDelay         int           `dynamo:",omitempty"`
+	HideReadReceipts  bool          `dynamo:",omitempty"`
+	Inactive          bool          `dynamo:",omitempty"`
+	// BlockLabels counts the anonymous labels handed out to the blocks of the user
+	BlockLabels int32     `dynamo:",omitempty"`
+	LinkKey     int32     `index:"LinkKey-GSI,hash"`
+	CreatedAt   time.Time `dynamo:",unixtime" index:"LinkKey-GSI,range"`
 
-type State string
+	// ContactUUID and ReplyMessageID are the legacy storage of the sending state
+	// and are only read to carry over the states set before payloads existed
+	ContactUUID    string `dynamo:",omitempty"`
+	ReplyMessageID int64  `dynamo:",omitempty"`
 
-const (
-	Idle            State = "IDLE"
-	Sending         State = "SENDING"
-	SettingUsername State = "SETTING_USERNAME"
-)
+	// Blacklist is the legacy storage of blocks and is only read to migrate it into block records
+	Blacklist []string `dynamo:",set,omitempty,omitemptyelem"`
+}
+
+// Location returns the time zone of the user, UTC if the user hasn't set one
+// or it can't be loaded anymore
+func (u *User) Location() *time.Location {
+	if u.Timezone == "" {
+		return time.UTC
+	}
+	location, err := i18n.LoadTimezone(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
@@ -1,6 +1,7 @@
 package users
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
@@ -9,15 +10,24 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/bugfloyd/anonymous-telegram-bot/common/usernames"
 	"github.com/google/uuid"
 	"github.com/guregu/dynamo"
 )
 
+// ErrNotFound is returned when the requested item does not exist
+var ErrNotFound = dynamo.ErrNotFound
+
 type UserRepository struct {
-	table dynamo.Table
+	db        *dynamo.DB
+	table     dynamo.Table
+	usernames dynamo.Table
+	slugs     dynamo.Table
 }
 
-func NewUserRepository() (*UserRepository, error) {
+// NewDB connects to DynamoDB, the repositories serving one update or run of
+// the jobs share the connection
+func NewDB() *dynamo.DB {
 	var sess *session.Session
 	customDynamoDbEndpoint := os.Getenv("DYNAMODB_ENDPOINT")
 	awsRegion := os.Getenv("AWS_REGION")
@@ -31,10 +41,15 @@ func NewUserRepository() (*UserRepository, error) {
 		sess = session.Must(session.NewSession(&aws.Config{Region: aws.String(awsRegion)}))
 	}
 
-	db := dynamo.New(sess)
+	return dynamo.New(sess)
+}
 
+func NewUserRepository(db *dynamo.DB) (*UserRepository, error) {
 	return &UserRepository{
-		table: db.Table("AnonymousBot"),
+		db:        db,
+		table:     db.Table("AnonymousBot"),
+		usernames: db.Table("AnonymousBotUsernames"),
+		slugs:     db.Table("AnonymousBotSlugs"),
 	}, nil
 }
 
@@ -57,7 +72,7 @@ func (repo *UserRepository) ReadUserByUUID(uuid string) (*User, error) {
 	var u User
 	err := repo.table.Get("UUID", uuid).One(&u)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	return &u, nil
 }
@@ -116,73 +131,155 @@ func (repo *UserRepository) UpdateUser(user *User, updates map[string]interface{
 	return nil
 }
 
-func (repo *UserRepository) ResetUserState(user *User) error {
-	err := repo.UpdateUser(user, map[string]interface{}{
-		"State":          Idle,
-		"ContactUUID":    "",
-		"ReplyMessageID": 0,
-	})
+// DeleteUser removes the user item and releases its username, which also
+// frees its username and link keys in the indexes
+func (repo *UserRepository) DeleteUser(user *User) error {
+	tx := repo.db.WriteTx()
+	tx.Delete(repo.table.Delete("UUID", user.UUID))
+	if user.Username != "" {
+		tx.Put(repo.releaseClaim(user, user.Username, time.Now()))
+	}
+	err := tx.Run()
 	if err != nil {
-		return fmt.Errorf("failed to reset user state: %w", err)
+		return fmt.Errorf("failed to delete user: %w", err)
 	}
 	return nil
 }
 
-func (repo *UserRepository) UpdateBlacklist(user *User, method string, value string) error {
-	updateBuilder := repo.table.Update("UUID", user.UUID)
+// ClaimUsername atomically reserves the username for the user, releases the
+// previous username of the user and resets the user state. Usernames released
+// by other users can be claimed after the quarantine duration.
+func (repo *UserRepository) ClaimUsername(user *User, username string, quarantine time.Duration) error {
+	// Usernames set before claims existed have no claim item, check the index for them
+	existingUser, err := repo.ReadUserByUsername(username)
+	if err == nil && existingUser.UUID != user.UUID {
+		return ErrUsernameTaken
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
 
-	switch method {
-	case "add":
-		updateBuilder = updateBuilder.AddStringsToSet("Blacklist", value)
-	case "delete":
-		updateBuilder = updateBuilder.DeleteStringsFromSet("Blacklist", value)
-	case "clear":
-		updateBuilder = updateBuilder.Set("Blacklist", nil)
-	default:
-		return fmt.Errorf("invalid method")
+	skeleton := usernames.Skeleton(username)
+	var similar []UsernameClaim
+	err = repo.usernames.Get("Skeleton", skeleton).Index("Skeleton-GSI").All(&similar)
+	if err != nil {
+		return fmt.Errorf("failed to get similar usernames: %w", err)
+	}
+	for _, claim := range similar {
+		if claim.Username != username && claim.OwnerUUID != user.UUID && claim.isActive(quarantine) {
+			return ErrUsernameLookAlike
+		}
 	}
 
-	err := updateBuilder.Run()
+	now := time.Now()
+	tx := repo.db.WriteTx()
+	tx.Put(repo.usernames.Put(UsernameClaim{
+		Username:  username,
+		Skeleton:  skeleton,
+		OwnerUUID: user.UUID,
+		CreatedAt: now,
+	}).If("attribute_not_exists('Username') OR 'OwnerUUID' = ? OR 'ReleasedAt' < ?", user.UUID, now.Add(-quarantine).Unix()))
+	tx.Update(resetState(repo.table.Update("UUID", user.UUID).
+		Set("Username", username).
+		Set("UsernameChangedAt", now.Unix())))
+	if user.Username != "" && user.Username != username {
+		tx.Put(repo.releaseClaim(user, user.Username, now))
+	}
 
+	err = tx.Run()
+	if dynamo.IsCondCheckFailed(err) {
+		var claim UsernameClaim
+		err = repo.usernames.Get("Username", username).Consistent(true).One(&claim)
+		if err == nil && !claim.ReleasedAt.IsZero() {
+			return ErrUsernameQuarantined
+		}
+		return ErrUsernameTaken
+	}
 	if err != nil {
-		return fmt.Errorf("failed to %s blacklist: %w", method, err)
+		return fmt.Errorf("failed to claim username: %w", err)
 	}
 
-	// Update the in-memory user data
-	switch method {
-	case "add":
-		// Ensure the value is not already in the blacklist to avoid duplicates
-		if !contains(user.Blacklist, value) {
-			user.Blacklist = append(user.Blacklist, value)
-		}
-	case "delete":
-		// Remove the value from the slice
-		user.Blacklist = removeFromSlice(user.Blacklist, value)
-	case "clear":
-		// Clear the slice
-		user.Blacklist = []string{}
+	user.Username = username
+	user.UsernameChangedAt = now
+	user.clearState()
+	return nil
+}
+
+// ReleaseUsername removes the username of the user, quarantines it and resets the user state
+func (repo *UserRepository) ReleaseUsername(user *User) error {
+	now := time.Now()
+	tx := repo.db.WriteTx()
+	tx.Update(resetState(repo.table.Update("UUID", user.UUID).
+		Set("UsernameChangedAt", now.Unix()).
+		Remove("Username")))
+	if user.Username != "" {
+		tx.Put(repo.releaseClaim(user, user.Username, now))
+	}
+
+	err := tx.Run()
+	if err != nil {
+		return fmt.Errorf("failed to release username: %w", err)
 	}
 
+	user.Username = ""
+	user.UsernameChangedAt = now
+	user.clearState()
 	return nil
 }
 
-// Utility function to check if a slice contains a string
-func contains(slice []string, value string) bool {
-	for _, item := range slice {
-		if item == value {
-			return true
+// releaseClaim marks the username claim as released if the user owns it,
+// usernames set before claims existed get a released claim as well
+func (repo *UserRepository) releaseClaim(user *User, username string, releasedAt time.Time) *dynamo.Put {
+	return repo.usernames.Put(UsernameClaim{
+		Username:   username,
+		Skeleton:   usernames.Skeleton(username),
+		OwnerUUID:  user.UUID,
+		CreatedAt:  releasedAt,
+		ReleasedAt: releasedAt,
+	}).If("attribute_not_exists('Username') OR 'OwnerUUID' = ?", user.UUID)
+}
+
+// BackfillUsernameClaims gives the usernames set before claims existed a
+// claim, so look-alikes of them are found through the Skeleton-GSI as well.
+// It returns the number of claims added and can be run again safely.
+func (repo *UserRepository) BackfillUsernameClaims() (int, error) {
+	iter := repo.table.Scan().Filter("attribute_exists('Username')").Iter()
+	added := 0
+	for {
+		var u User
+		if !iter.Next(&u) {
+			break
 		}
+		createdAt := u.UsernameChangedAt
+		if createdAt.IsZero() {
+			createdAt = u.CreatedAt
+		}
+		err := repo.usernames.Put(UsernameClaim{
+			Username:  u.Username,
+			Skeleton:  usernames.Skeleton(u.Username),
+			OwnerUUID: u.UUID,
+			CreatedAt: createdAt,
+		}).If("attribute_not_exists('Username')").Run()
+		if dynamo.IsCondCheckFailed(err) {
+			continue
+		}
+		if err != nil {
+			return added, fmt.Errorf("failed to backfill username claim: %w", err)
+		}
+		added++
+	}
+	if iter.Err() != nil {
+		return added, fmt.Errorf("failed to scan usernames: %w", iter.Err())
 	}
-	return false
+	return added, nil
 }
 
-// Utility function to remove an element from a slice
-func removeFromSlice(slice []string, value string) []string {
-	newSlice := make([]string, 0)
-	for _, item := range slice {
-		if item != value {
-			newSlice = append(newSlice, item)
-		}
+// ClearBlacklist removes the legacy blacklist string set from the user item
+func (repo *UserRepository) ClearBlacklist(user *User) error {
+	err := repo.table.Update("UUID", user.UUID).Remove("Blacklist").Run()
+	if err != nil {
+		return fmt.Errorf("failed to clear blacklist: %w", err)
 	}
-	return newSlice
+	user.Blacklist = nil
+	return nil
 }
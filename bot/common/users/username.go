@@ -0,0 +1,31 @@
+package users
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUsernameTaken is returned when another user already owns the username
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrUsernameQuarantined is returned when the username was released by another user recently
+	ErrUsernameQuarantined = errors.New("username is quarantined")
+	// ErrUsernameLookAlike is returned when the username looks like a username owned by another user
+	ErrUsernameLookAlike = errors.New("username looks like an existing username")
+)
+
+// UsernameClaim reserves a username for a single user. Its conditional write
+// is what keeps usernames unique, the Username-GSI is only used for lookups.
+// Released claims stay in place until their quarantine is over.
+type UsernameClaim struct {
+	Username   string `dynamo:",hash"`
+	Skeleton   string `dynamo:",omitempty" index:"Skeleton-GSI,hash"`
+	OwnerUUID  string
+	CreatedAt  time.Time `dynamo:",unixtime"`
+	ReleasedAt time.Time `dynamo:",unixtime,omitempty"`
+}
+
+// isActive reports whether the claim still keeps the username from other users
+func (c *UsernameClaim) isActive(quarantine time.Duration) bool {
+	return c.ReleasedAt.IsZero() || time.Since(c.ReleasedAt) < quarantine
+}
@@ -9,6 +9,7 @@ require (
 	github.com/google/uuid v1.6.0
 	github.com/guregu/dynamo v1.22.1
 	github.com/sqids/sqids-go v0.4.1
+	golang.org/x/text v0.14.0
 )
 
 require (
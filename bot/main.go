@@ -6,5 +6,5 @@ import (
 )
 
 func main() {
-	lambda.Start(common.InitBot)
+	lambda.Start(common.HandleLambdaEvent)
 }
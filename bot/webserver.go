@@ -8,9 +8,16 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
 func main() {
+	// Delayed messages are delivered by a ticker here, unlike on Lambda where a schedule runs them
+	err := common.StartJobTicker(time.Second)
+	if err != nil {
+		log.Fatalf("failed to start job ticker: %v", err)
+	}
+
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Read the body of the incoming HTTP request
 		body, err := io.ReadAll(r.Body)
@@ -11,10 +11,13 @@ resource "aws_lambda_function" "anonymous_bot" {
   runtime          = "provided.al2023"
   role             = aws_iam_role.lambda_exec_role.arn
   source_code_hash = filebase64sha256(var.zip_bundle_path)
+  # Scheduled invocations keep running the jobs coming due for most of a minute
+  timeout = 60
 
   environment {
     variables = {
       DEFAULT_LANGUAGE = var.default_language
+      ADMIN_USER_IDS   = var.admin_user_ids
     }
   }
 }
@@ -146,6 +149,190 @@ resource "aws_dynamodb_table" "main" {
   }
 }
 
+resource "aws_dynamodb_table" "blocks" {
+  name         = "AnonymousBotBlocks"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "BlockerUUID"
+  range_key    = "BlockedUUID"
+
+  attribute {
+    name = "BlockerUUID"
+    type = "S"
+  }
+
+  attribute {
+    name = "BlockedUUID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "BlockedUUID-GSI"
+    hash_key        = "BlockedUUID"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "ExpiresAt"
+    enabled        = true
+  }
+
+  lifecycle {
+    prevent_destroy = false
+  }
+}
+
+resource "aws_dynamodb_table" "messages" {
+  name         = "AnonymousBotMessages"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "UUID"
+
+  attribute {
+    name = "UUID"
+    type = "S"
+  }
+
+  attribute {
+    name = "SenderUUID"
+    type = "S"
+  }
+
+  attribute {
+    name = "ReceiverUUID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "SenderUUID-GSI"
+    hash_key        = "SenderUUID"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "ReceiverUUID-GSI"
+    hash_key        = "ReceiverUUID"
+    projection_type = "ALL"
+  }
+
+  lifecycle {
+    prevent_destroy = false
+  }
+}
+
+resource "aws_dynamodb_table" "usernames" {
+  name         = "AnonymousBotUsernames"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "Username"
+
+  attribute {
+    name = "Username"
+    type = "S"
+  }
+
+  attribute {
+    name = "Skeleton"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "Skeleton-GSI"
+    hash_key        = "Skeleton"
+    projection_type = "ALL"
+  }
+
+  lifecycle {
+    prevent_destroy = false
+  }
+}
+
+resource "aws_dynamodb_table" "slugs" {
+  name         = "AnonymousBotSlugs"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "Slug"
+
+  attribute {
+    name = "Slug"
+    type = "S"
+  }
+
+  attribute {
+    name = "OwnerUUID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "OwnerUUID-GSI"
+    hash_key        = "OwnerUUID"
+    projection_type = "ALL"
+  }
+
+  lifecycle {
+    prevent_destroy = false
+  }
+}
+
+resource "aws_dynamodb_table" "jobs" {
+  name         = "AnonymousBotJobs"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "UUID"
+
+  attribute {
+    name = "UUID"
+    type = "S"
+  }
+
+  attribute {
+    name = "Queue"
+    type = "S"
+  }
+
+  attribute {
+    name = "DueAt"
+    type = "N"
+  }
+
+  attribute {
+    name = "OwnerUUID"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "Queue-DueAt-GSI"
+    hash_key        = "Queue"
+    range_key       = "DueAt"
+    projection_type = "ALL"
+  }
+
+  global_secondary_index {
+    name            = "OwnerUUID-GSI"
+    hash_key        = "OwnerUUID"
+    projection_type = "ALL"
+  }
+
+  lifecycle {
+    prevent_destroy = false
+  }
+}
+
+# Scheduled jobs
+resource "aws_cloudwatch_event_rule" "jobs_schedule" {
+  name                = "AnonymousBotJobs"
+  description         = "Runs the due jobs of the bot, like delayed and scheduled message deliveries"
+  schedule_expression = "rate(1 minute)"
+}
+
+resource "aws_cloudwatch_event_target" "jobs_lambda" {
+  rule = aws_cloudwatch_event_rule.jobs_schedule.name
+  arn  = aws_lambda_function.anonymous_bot.arn
+}
+
+resource "aws_lambda_permission" "events_lambda" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.anonymous_bot.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.jobs_schedule.arn
+}
+
 resource "aws_iam_policy" "lambda_dynamodb_policy" {
   name        = "AnonymousDynamoDBLambdaPolicy"
   description = "Policy to allow Lambda function to manage DynamoDB"
@@ -163,9 +350,17 @@ resource "aws_iam_policy" "lambda_dynamodb_policy" {
           "dynamodb:BatchGetItem",
           "dynamodb:BatchWriteItem",
           "dynamodb:DescribeTable",
+          "dynamodb:ConditionCheckItem",
         ],
-        Effect   = "Allow",
-        Resource = aws_dynamodb_table.main.arn
+        Effect = "Allow",
+        Resource = [
+          aws_dynamodb_table.main.arn,
+          aws_dynamodb_table.blocks.arn,
+          aws_dynamodb_table.messages.arn,
+          aws_dynamodb_table.usernames.arn,
+          aws_dynamodb_table.slugs.arn,
+          aws_dynamodb_table.jobs.arn
+        ]
       },
       {
         Action = [
@@ -175,7 +370,14 @@ resource "aws_iam_policy" "lambda_dynamodb_policy" {
         Resource = [
           "${aws_dynamodb_table.main.arn}/index/UserID-GSI",
           "${aws_dynamodb_table.main.arn}/index/Username-GSI",
-          "${aws_dynamodb_table.main.arn}/index/LinkKey-GSI"
+          "${aws_dynamodb_table.main.arn}/index/LinkKey-GSI",
+          "${aws_dynamodb_table.blocks.arn}/index/BlockedUUID-GSI",
+          "${aws_dynamodb_table.messages.arn}/index/SenderUUID-GSI",
+          "${aws_dynamodb_table.messages.arn}/index/ReceiverUUID-GSI",
+          "${aws_dynamodb_table.usernames.arn}/index/Skeleton-GSI",
+          "${aws_dynamodb_table.slugs.arn}/index/OwnerUUID-GSI",
+          "${aws_dynamodb_table.jobs.arn}/index/Queue-DueAt-GSI",
+          "${aws_dynamodb_table.jobs.arn}/index/OwnerUUID-GSI"
         ]
       }
     ]
@@ -28,4 +28,9 @@ variable "zip_bundle_path" {
   description = "Local Lambda zip bundle path"
   type        = string
   default     = "../bot/lambda_function.zip"
-}
\ No newline at end of file
+}
+variable "admin_user_ids" {
+  description = "Comma separated Telegram user IDs allowed to run the admin commands"
+  type        = string
+  default     = ""
+}